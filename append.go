@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: MIT
+
+package bipf
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/ssb-ngi-pointer/go-bipf/internal/varint"
+)
+
+// The AppendXxx functions encode a value and append it to dst, returning the extended slice.
+// They only allocate if dst has to grow, so reusing a buffer between writes avoids allocations completely.
+
+// appendTag appends the tag for a value of type t and the given length
+func appendTag(dst []byte, t Type, length int) []byte {
+	return varint.AppendVarint(dst, uint64(length)<<tagSize|uint64(t))
+}
+
+// AppendString appends the encoded string s to dst
+func AppendString(dst []byte, s string) []byte {
+	dst = appendTag(dst, TypeString, len(s))
+	return append(dst, s...)
+}
+
+// AppendBytes appends b encoded as a buffer to dst
+func AppendBytes(dst []byte, b []byte) []byte {
+	dst = appendTag(dst, TypeBuffer, len(b))
+	return append(dst, b...)
+}
+
+// AppendInt32 appends the encoded integer v to dst
+func AppendInt32(dst []byte, v int32) []byte {
+	var buf [5]byte
+	buf[0] = byte(4<<tagSize | TypeInt32)
+	binary.LittleEndian.PutUint32(buf[1:], uint32(v))
+	return append(dst, buf[:]...)
+}
+
+// AppendDouble appends the encoded float v to dst, keeping its bits as they are
+func AppendDouble(dst []byte, v float64) []byte {
+	var buf [9]byte
+	buf[0] = byte(8<<tagSize | TypeDouble)
+	binary.LittleEndian.PutUint64(buf[1:], math.Float64bits(v))
+	return append(dst, buf[:]...)
+}
+
+// AppendBool appends the encoded bool v to dst
+func AppendBool(dst []byte, v bool) []byte {
+	if v {
+		return append(dst, byte(1<<tagSize|TypeBool), 0x01)
+	}
+	return append(dst, byte(1<<tagSize|TypeBool), 0x00)
+}
+
+// AppendNull appends an encoded null to dst
+func AppendNull(dst []byte) []byte {
+	return append(dst, byte(TypeBool))
+}
+
+// BeginObject starts an object at the end of dst.
+// Its keys and values are appended after it, alternating AppendString for the keys and any value,
+// until EndObject is called with the returned offset to fill in the length of the object.
+func BeginObject(dst []byte) ([]byte, int) {
+	return beginContainer(dst)
+}
+
+// EndObject finishes the object started at offset by BeginObject
+func EndObject(dst []byte, offset int) []byte {
+	return endContainer(dst, offset, TypeObject)
+}
+
+// BeginArray starts an array at the end of dst.
+// Its items are appended after it, until EndArray is called with the returned offset.
+func BeginArray(dst []byte) ([]byte, int) {
+	return beginContainer(dst)
+}
+
+// EndArray finishes the array started at offset by BeginArray
+func EndArray(dst []byte, offset int) []byte {
+	return endContainer(dst, offset, TypeArray)
+}
+
+// beginContainer reserves a single byte for the tag,
+// which is enough for containers of up to 15 bytes
+func beginContainer(dst []byte) ([]byte, int) {
+	return append(dst, 0), len(dst)
+}
+
+// endContainer writes the tag of the container started at offset.
+// If it doesn't fit into the reserved byte, the entries are moved back to make room for it.
+func endContainer(dst []byte, offset int, t Type) []byte {
+	length := len(dst) - offset - 1
+	tag := uint64(length)<<tagSize | uint64(t)
+
+	if n := varint.SizeVarint(tag); n > 1 {
+		dst = append(dst, make([]byte, n-1)...)
+		copy(dst[offset+n:], dst[offset+1:offset+1+length])
+	}
+	varint.AppendVarint(dst[offset:offset], tag)
+	return dst
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: MIT
+
+package bipf_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+func TestAppendScalars(t *testing.T) {
+	r := require.New(t)
+
+	long := strings.Repeat("x", 100)
+	for i, tc := range []struct {
+		Got  []byte
+		Want bipf.Valuer
+	}{
+		{bipf.AppendString(nil, ""), bipf.String("")},
+		{bipf.AppendString(nil, long), bipf.String(long)},
+		{bipf.AppendBytes(nil, nil), bipf.Bytes(nil)},
+		{bipf.AppendBytes(nil, []byte{0xde, 0xad}), bipf.Bytes([]byte{0xde, 0xad})},
+		{bipf.AppendInt32(nil, -1), bipf.Int32(-1)},
+		{bipf.AppendDouble(nil, math.Pi), bipf.Double(math.Pi)},
+		{bipf.AppendBool(nil, true), bipf.Bool(true)},
+		{bipf.AppendBool(nil, false), bipf.Bool(false)},
+		{bipf.AppendNull(nil), bipf.Null()},
+	} {
+		r.Equal(encodeValuer(t, tc.Want), tc.Got, "case %d", i)
+	}
+}
+
+func TestAppendContainers(t *testing.T) {
+	r := require.New(t)
+
+	long := strings.Repeat("x", 200)
+
+	// prefix, to check that offsets are relative to the whole buffer
+	buf := []byte{0xff}
+
+	buf, obj := bipf.BeginObject(buf)
+	buf = bipf.AppendString(buf, "empty")
+	buf, arr := bipf.BeginArray(buf)
+	buf = bipf.EndArray(buf, arr)
+	buf = bipf.AppendString(buf, "list")
+	buf, arr = bipf.BeginArray(buf)
+	buf = bipf.AppendInt32(buf, 1)
+	buf = bipf.AppendString(buf, long)
+	buf, inner := bipf.BeginObject(buf)
+	buf = bipf.AppendString(buf, "ok")
+	buf = bipf.AppendBool(buf, true)
+	buf = bipf.EndObject(buf, inner)
+	buf = bipf.EndArray(buf, arr)
+	buf = bipf.AppendString(buf, "n")
+	buf = bipf.AppendNull(buf)
+	buf = bipf.EndObject(buf, obj)
+
+	want := bipf.MapOf(map[string]bipf.Valuer{
+		"empty": bipf.ListOf(),
+		"list": bipf.ListOf(
+			bipf.Int32(1),
+			bipf.String(long),
+			bipf.MapOf(map[string]bipf.Valuer{"ok": bipf.Bool(true)}),
+		),
+		"n": bipf.Null(),
+	}, "empty", "list", "n")
+
+	r.Equal(byte(0xff), buf[0])
+	r.Equal(encodeValuer(t, want), buf[1:])
+	r.NoError(bipf.Validate(buf[1:]))
+}
+
+func TestAppendNoAllocs(t *testing.T) {
+	buf := make([]byte, 0, 1024)
+	blob := []byte("some blob data")
+
+	allocs := testing.AllocsPerRun(100, func() {
+		b, obj := bipf.BeginObject(buf[:0])
+		b = bipf.AppendString(b, "type")
+		b = bipf.AppendString(b, "post")
+		b = bipf.AppendString(b, "seq")
+		b = bipf.AppendInt32(b, 42)
+		b = bipf.AppendString(b, "blob")
+		b = bipf.AppendBytes(b, blob)
+		b = bipf.AppendString(b, "ok")
+		b = bipf.AppendBool(b, true)
+		b = bipf.AppendString(b, "d")
+		b = bipf.AppendDouble(b, 0.5)
+		bipf.EndObject(b, obj)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
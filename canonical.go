@@ -0,0 +1,240 @@
+// SPDX-License-Identifier: MIT
+
+package bipf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/ssb-ngi-pointer/go-bipf/internal/varint"
+)
+
+// The canonical encoding of a value is the same on every run, so that it can be hashed or signed.
+// In it, object keys are sorted bytewise and unique, tags use the shortest varint that holds them
+// and every NaN is encoded as the quiet NaN 0x7ff8000000000000.
+
+// canonicalNaN are the bits every NaN is encoded with in the canonical form
+const canonicalNaN = 0x7ff8000000000000
+
+// Canonical returns the canonical form of v.
+//
+// Wrap values from MapOf in it to get the same bytes on every run, regardless of the order of the map.
+// Valuers not created by this package are encoded and converted right away; their errors are returned by WriteTo.
+func Canonical(v Valuer) Valuer {
+	switch tv := v.(type) {
+	case stringValue, bytesValue, int32Value, boolValue, nullValue:
+		return v
+
+	case doubleValue:
+		if math.IsNaN(float64(tv)) {
+			return doubleValue(math.Float64frombits(canonicalNaN))
+		}
+		return v
+
+	case *listValue:
+		items := make([]Valuer, len(tv.items))
+		for i, item := range tv.items {
+			items[i] = Canonical(item)
+		}
+		return ListOf(items...)
+
+	case *mapValue:
+		if tv.err != nil {
+			return v
+		}
+
+		order := make([]int, len(tv.keys))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return tv.keys[order[i]] < tv.keys[order[j]]
+		})
+
+		keys := make([]string, len(order))
+		values := make([]Valuer, len(order))
+		for i, idx := range order {
+			keys[i] = tv.keys[idx]
+			if i > 0 && keys[i-1] == keys[i] {
+				return &rawValue{err: fmt.Errorf("bipf: object has repeated key %q", keys[i])}
+			}
+			values[i] = Canonical(tv.values[idx])
+		}
+		return objectOf(keys, values)
+
+	case *rawValue:
+		return v
+	}
+
+	var buf bytes.Buffer
+	if _, err := v.WriteTo(&buf); err != nil {
+		return &rawValue{err: err}
+	}
+	data, err := AppendCanonical(nil, buf.Bytes())
+	return &rawValue{data: data, err: err}
+}
+
+// MarshalCanonical is like Marshal but returns the canonical encoding of v
+func MarshalCanonical(v interface{}) ([]byte, error) {
+	val, err := valuerOf(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return encodeValuer(Canonical(val))
+}
+
+// rawValue holds a value that is already encoded
+type rawValue struct {
+	data []byte
+
+	// err is a problem with creating the data, returned when writing
+	err error
+}
+
+func (rv *rawValue) EncodedSize() int { return len(rv.data) }
+
+func (rv *rawValue) WriteTo(w io.Writer) (int64, error) {
+	if rv.err != nil {
+		return 0, rv.err
+	}
+	n, err := w.Write(rv.data)
+	return int64(n), err
+}
+
+// IsCanonical reports whether data holds exactly one well-formed value in its canonical encoding
+func IsCanonical(data []byte) bool {
+	if Validate(data) != nil {
+		return false
+	}
+	return isCanonical(View(data), 0)
+}
+
+// isCanonical checks the value at off, which is already validated
+func isCanonical(v View, off int) bool {
+	tag, n := varint.ConsumeVarint(v[off:])
+	if n != varint.SizeVarint(tag) {
+		return false
+	}
+
+	typ, length, start, _ := v.Tag(off)
+	end := start + length
+
+	switch typ {
+	case TypeDouble:
+		f, _ := v.Double(off)
+		return !math.IsNaN(f) || math.Float64bits(f) == canonicalNaN
+
+	case TypeArray:
+		for pos := start; pos < end; pos, _ = v.Skip(pos) {
+			if !isCanonical(v, pos) {
+				return false
+			}
+		}
+
+	case TypeObject:
+		var lastKey []byte
+		for pos := start; pos < end; {
+			if !isCanonical(v, pos) {
+				return false
+			}
+			key, _ := v.StringBytes(pos)
+			if pos > start && bytes.Compare(lastKey, key) >= 0 {
+				return false
+			}
+			lastKey = key
+
+			pos, _ = v.Skip(pos)
+			if !isCanonical(v, pos) {
+				return false
+			}
+			pos, _ = v.Skip(pos)
+		}
+	}
+	return true
+}
+
+// AppendCanonical appends the canonical encoding of the value in data to dst.
+// It returns an error if data isn't well-formed or has an object with a repeated key.
+func AppendCanonical(dst, data []byte) ([]byte, error) {
+	if err := Validate(data); err != nil {
+		return dst, err
+	}
+	return appendCanonical(dst, View(data), 0)
+}
+
+// appendCanonical converts the value at off, which is already validated
+func appendCanonical(dst []byte, v View, off int) ([]byte, error) {
+	typ, length, start, _ := v.Tag(off)
+	value := v[start : start+length]
+
+	switch typ {
+	case TypeString, TypeBuffer:
+		return append(appendTag(dst, typ, length), value...), nil
+
+	case TypeInt32:
+		i, _ := v.Int32(off)
+		return AppendInt32(dst, i), nil
+
+	case TypeBool:
+		if length == 0 {
+			return AppendNull(dst), nil
+		}
+		return AppendBool(dst, value[0] == 1), nil
+
+	case TypeDouble:
+		f, _ := v.Double(off)
+		if math.IsNaN(f) {
+			f = math.Float64frombits(canonicalNaN)
+		}
+		return AppendDouble(dst, f), nil
+
+	case TypeArray:
+		var arr int
+		var err error
+		dst, arr = BeginArray(dst)
+		for pos := start; pos < start+length; pos, _ = v.Skip(pos) {
+			dst, err = appendCanonical(dst, v, pos)
+			if err != nil {
+				return dst, err
+			}
+		}
+		return EndArray(dst, arr), nil
+
+	case TypeObject:
+		type entry struct {
+			key   []byte
+			value int
+		}
+		var entries []entry
+		for pos := start; pos < start+length; {
+			key, _ := v.StringBytes(pos)
+			pos, _ = v.Skip(pos)
+			entries = append(entries, entry{key: key, value: pos})
+			pos, _ = v.Skip(pos)
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			return bytes.Compare(entries[i].key, entries[j].key) < 0
+		})
+
+		var obj int
+		var err error
+		dst, obj = BeginObject(dst)
+		for i, e := range entries {
+			if i > 0 && bytes.Equal(entries[i-1].key, e.key) {
+				return dst, fmt.Errorf("bipf: object has repeated key %q", e.key)
+			}
+			dst = append(appendTag(dst, TypeString, len(e.key)), e.key...)
+			dst, err = appendCanonical(dst, v, e.value)
+			if err != nil {
+				return dst, err
+			}
+		}
+		return EndObject(dst, obj), nil
+	}
+
+	return dst, fmt.Errorf("bipf: can't convert %s", typ)
+}
@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: MIT
+
+package bipf_test
+
+import (
+	"encoding/hex"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+func TestCanonical(t *testing.T) {
+	r := require.New(t)
+
+	nan := math.Float64frombits(0x7ff0000000000001)
+
+	build := func() bipf.Valuer {
+		return bipf.MapOf(map[string]bipf.Valuer{
+			"type": bipf.String("post"),
+			"nan":  bipf.Double(nan),
+			"list": bipf.ListOf(bipf.MapOf(map[string]bipf.Valuer{"b": bipf.Null(), "a": bipf.Int32(1)})),
+			"b":    bipf.Bool(true),
+			"":     bipf.Bytes([]byte{1, 2}),
+		})
+	}
+
+	want := encodeValuer(t, bipf.MapOf(map[string]bipf.Valuer{
+		"":     bipf.Bytes([]byte{1, 2}),
+		"b":    bipf.Bool(true),
+		"list": bipf.ListOf(bipf.MapOf(map[string]bipf.Valuer{"a": bipf.Int32(1), "b": bipf.Null()}, "a", "b")),
+		"nan":  bipf.Double(math.Float64frombits(0x7ff8000000000000)),
+		"type": bipf.String("post"),
+	}, "", "b", "list", "nan", "type"))
+	r.True(bipf.IsCanonical(want))
+
+	for i := 0; i < 10; i++ {
+		r.Equal(want, encodeValuer(t, bipf.Canonical(build())))
+	}
+	r.False(bipf.IsCanonical(encodeValuer(t, build())), "NaN payload")
+
+	got, err := bipf.AppendCanonical(nil, encodeValuer(t, build()))
+	r.NoError(err)
+	r.Equal(want, got)
+
+	// values from elsewhere are converted through their encoding
+	got = encodeValuer(t, bipf.Canonical(foreignValuer(encodeValuer(t, build()))))
+	r.Equal(want, got)
+}
+
+func TestMarshalCanonical(t *testing.T) {
+	r := require.New(t)
+
+	data, err := bipf.MarshalCanonical(testRepo{Type: "git", URL: "git://github.com/ssbc/bipf.git"})
+	r.NoError(err)
+	r.True(bipf.IsCanonical(data))
+
+	want := encodeValuer(t, bipf.MapOf(map[string]bipf.Valuer{
+		"type": bipf.String("git"),
+		"url":  bipf.String("git://github.com/ssbc/bipf.git"),
+	}, "type", "url"))
+	r.Equal(want, data)
+}
+
+func TestIsCanonical(t *testing.T) {
+	r := require.New(t)
+
+	for i, tc := range []struct {
+		Hex       string
+		Canonical bool
+		Fixed     string
+	}{
+		{"0861", true, "0861"},                                // "a"
+		{"880061", false, "0861"},                             // "a" with a two byte tag
+		{"c50008610e0108620e00", false, "4508610e0108620e00"}, // {a: true, b: false} with a two byte tag
+		{"4508620e0008610e01", false, "4508610e0108620e00"},   // {b: false, a: true}
+		{"43000000000000f87f", true, "43000000000000f87f"},    // NaN
+		{"43010000000000f07f", false, "43000000000000f87f"},   // NaN with a payload
+		{"a20001000000", false, "2201000000"},                 // int32 with a two byte tag
+		{"4508610e0108610e00", false, ""},                     // {a: true, a: false}
+		{"0e", false, ""},                                     // truncated
+		{"08610861", false, ""},                               // trailing data
+	} {
+		data, err := hex.DecodeString(tc.Hex)
+		r.NoError(err)
+		r.Equal(tc.Canonical, bipf.IsCanonical(data), "case %d", i)
+
+		fixed, err := bipf.AppendCanonical(nil, data)
+		if tc.Fixed == "" {
+			r.Error(err, "case %d", i)
+			continue
+		}
+		r.NoError(err, "case %d", i)
+		r.Equal(tc.Fixed, hex.EncodeToString(fixed), "case %d", i)
+		r.True(bipf.IsCanonical(fixed), "case %d", i)
+	}
+}
+
+// foreignValuer is a Valuer that isn't from the bipf package
+type foreignValuer []byte
+
+func (fv foreignValuer) EncodedSize() int { return len(fv) }
+
+func (fv foreignValuer) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(fv)
+	return int64(n), err
+}
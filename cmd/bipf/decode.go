@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+// decode reads bipf from r and writes it as indented JSON to w
+func decode(w io.Writer, r io.Reader, buffers bipf.BufferFormat) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	opts := bipf.JSONOptions{
+		Indent:  "  ",
+		Buffers: buffers,
+	}
+	if err := bipf.ToJSONWithOptions(w, data, opts); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func parseBufferFormat(name string) (bipf.BufferFormat, error) {
+	switch name {
+	case "base64":
+		return bipf.BufferBase64, nil
+	case "hex":
+		return bipf.BufferHex, nil
+	case "ssb":
+		return bipf.BufferSSB, nil
+	}
+	return 0, fmt.Errorf("unknown buffer format: %q", name)
+}
@@ -0,0 +1,29 @@
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+// encode reads a single JSON value from r and writes it as bipf to w.
+// The order of object keys is kept, unless canonical is set and they are sorted.
+func encode(w io.Writer, r io.Reader, canonical bool) error {
+	if !canonical {
+		return bipf.FromJSON(r, w)
+	}
+
+	var buf bytes.Buffer
+	if err := bipf.FromJSON(r, &buf); err != nil {
+		return err
+	}
+	data, err := bipf.AppendCanonical(nil, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
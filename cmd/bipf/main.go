@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: MIT
+
+// bipf converts between JSON and bipf.
+//
+// Usage:
+//
+//	bipf encode < message.json > message.bipf
+//	bipf encode -canonical < message.json > message.bipf
+//	bipf decode < message.bipf
+//	bipf decode -buffers hex < message.bipf
+//	bipf inspect < message.bipf
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+
+	var err error
+	switch cmd := os.Args[1]; cmd {
+	case "encode":
+		flags := flag.NewFlagSet("encode", flag.ExitOnError)
+		canonical := flags.Bool("canonical", false, "write the canonical encoding, with sorted object keys")
+		flags.Parse(os.Args[2:])
+		err = encode(out, os.Stdin, *canonical)
+	case "decode":
+		flags := flag.NewFlagSet("decode", flag.ExitOnError)
+		buffers := flags.String("buffers", "base64", "how buffers are written: base64, hex or ssb")
+		flags.Parse(os.Args[2:])
+
+		var format bipf.BufferFormat
+		format, err = parseBufferFormat(*buffers)
+		if err == nil {
+			err = decode(out, os.Stdin, format)
+		}
+	case "inspect":
+		err = inspect(out, os.Stdin)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %q\n", cmd)
+		usage()
+	}
+
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bipf:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: %s <command>
+
+commands:
+	encode	read JSON from stdin and write bipf to stdout
+		-canonical writes the canonical encoding, with sorted object keys
+	decode	read bipf from stdin and write JSON to stdout
+		-buffers base64|hex|ssb sets how buffers are written, ssb as "&...sha256" blob references
+	inspect	read bipf from stdin and write an annotated listing of its structure to stdout
+`, os.Args[0])
+	os.Exit(2)
+}
+
+// inspect writes the listing of bipf.Dump for the data from r to w
+func inspect(w io.Writer, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return bipf.Dump(w, data)
+}
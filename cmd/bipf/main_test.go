@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+type fixture struct {
+	Name   string
+	JSON   string
+	Binary string
+}
+
+func loadFixtures(t *testing.T) []fixture {
+	b, err := ioutil.ReadFile("../../fixtures.json")
+	require.NoError(t, err)
+
+	var fixtures []fixture
+	require.NoError(t, json.Unmarshal(b, &fixtures))
+	return fixtures
+}
+
+func TestEncodeFixtures(t *testing.T) {
+	for _, f := range loadFixtures(t) {
+		if strings.Contains(f.Name, "various types") {
+			// has a Buffer, which can't come from JSON
+			continue
+		}
+
+		f := f
+		t.Run(f.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			jsonData, err := hex.DecodeString(f.JSON)
+			r.NoError(err)
+
+			var encoded bytes.Buffer
+			r.NoError(encode(&encoded, bytes.NewReader(jsonData), false))
+			r.Equal(f.Binary, hex.EncodeToString(encoded.Bytes()))
+
+			var decoded bytes.Buffer
+			r.NoError(decode(&decoded, &encoded, bipf.BufferBase64))
+
+			var want, got interface{}
+			r.NoError(json.Unmarshal(jsonData, &want))
+			r.NoError(json.Unmarshal(decoded.Bytes(), &got))
+			r.Equal(want, got)
+		})
+	}
+}
+
+func TestDecodeKeepsOrder(t *testing.T) {
+	r := require.New(t)
+
+	input := `{"z":1,"a":[true,null,1.5,-2147483649],"m":"<x>","z":2}`
+
+	var encoded, decoded bytes.Buffer
+	r.NoError(encode(&encoded, strings.NewReader(input), false))
+	r.NoError(decode(&decoded, &encoded, bipf.BufferBase64))
+
+	r.Equal(`{
+  "z": 2,
+  "a": [
+    true,
+    null,
+    1.5,
+    -2147483649
+  ],
+  "m": "<x>"
+}
+`, decoded.String())
+
+	r.Error(encode(&encoded, strings.NewReader(`{} {}`), false))
+	r.Error(encode(&encoded, strings.NewReader(`{"a":`), false))
+}
+
+func TestEncodeCanonical(t *testing.T) {
+	r := require.New(t)
+
+	var encoded, decoded bytes.Buffer
+	r.NoError(encode(&encoded, strings.NewReader(`{"z":1,"a":{"y":null,"b":[]},"m":"x"}`), true))
+	r.True(bipf.IsCanonical(encoded.Bytes()))
+	r.NoError(decode(&decoded, &encoded, bipf.BufferBase64))
+
+	r.Equal(`{
+  "a": {
+    "b": [],
+    "y": null
+  },
+  "m": "x",
+  "z": 1
+}
+`, decoded.String())
+}
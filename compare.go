@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: MIT
+
+package bipf
+
+import (
+	"bytes"
+	"math"
+)
+
+// Compare compares the encoded values a and b without decoding them into Go values.
+// The result is 0 if a == b, -1 if a < b and +1 if a > b.
+//
+// Int32 and Double values are compared by their numbers, with NaN sorting before all other numbers.
+// Strings and buffers are compared bytewise, bools sort null before false before true.
+// Arrays and objects compare their entries in order, a shorter one sorting first if all its entries are equal.
+// Values of different types are ordered by their type, with Int32 and Double counting as the same type.
+//
+// Only the first value in a and b is compared. An error is returned if either of them is malformed
+// or if the arrays and objects being compared are nested deeper than MaxNesting.
+func Compare(a, b []byte) (int, error) {
+	return compareAt(View(a), 0, View(b), 0, 1)
+}
+
+// CompareAt compares the value at offset in buf to value, like Compare.
+// For repeated comparisons against the same value, encode it once and use Compare instead.
+func CompareAt(buf []byte, offset int, value Valuer) (int, error) {
+	var enc bytes.Buffer
+	if _, err := value.WriteTo(&enc); err != nil {
+		return 0, err
+	}
+	return compareAt(View(buf), offset, View(enc.Bytes()), 0, 1)
+}
+
+// compareAt compares the values at aOffset and bOffset, which are nested depth levels deep
+func compareAt(a View, aOffset int, b View, bOffset int, depth int) (int, error) {
+	aType, aLen, aStart, err := a.Tag(aOffset)
+	if err != nil {
+		return 0, err
+	}
+	bType, bLen, bStart, err := b.Tag(bOffset)
+	if err != nil {
+		return 0, err
+	}
+
+	if isNumber(aType) && isNumber(bType) {
+		aNum, err := numberAt(a, aOffset, aType)
+		if err != nil {
+			return 0, err
+		}
+		bNum, err := numberAt(b, bOffset, bType)
+		if err != nil {
+			return 0, err
+		}
+		return compareNumbers(aNum, bNum), nil
+	}
+
+	if aType != bType {
+		return compareInts(typeRank(aType), typeRank(bType)), nil
+	}
+
+	if err := checkNesting(aType, depth); err != nil {
+		return 0, err
+	}
+
+	aValue, bValue := a[aStart:aStart+aLen], b[bStart:bStart+bLen]
+
+	switch aType {
+	case TypeString, TypeBuffer:
+		return bytes.Compare(aValue, bValue), nil
+
+	case TypeBool:
+		// null has no value byte and sorts first
+		return bytes.Compare(aValue, bValue), nil
+
+	default: // arrays and objects
+		aPos, aEnd := aStart, aStart+aLen
+		bPos, bEnd := bStart, bStart+bLen
+		for aPos < aEnd && bPos < bEnd {
+			cmp, err := compareAt(a, aPos, b, bPos, depth+1)
+			if err != nil || cmp != 0 {
+				return cmp, err
+			}
+
+			aPos, err = a.Skip(aPos)
+			if err != nil {
+				return 0, err
+			}
+			bPos, err = b.Skip(bPos)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return compareInts(aEnd-aPos, bEnd-bPos), nil
+	}
+}
+
+func isNumber(t Type) bool {
+	return t == TypeInt32 || t == TypeDouble
+}
+
+// typeRank orders the types for comparisons, counting both number types as one
+func typeRank(t Type) int {
+	if t == TypeDouble {
+		return int(TypeInt32)
+	}
+	return int(t)
+}
+
+func numberAt(v View, offset int, t Type) (float64, error) {
+	if t == TypeInt32 {
+		i, err := v.Int32(offset)
+		return float64(i), err
+	}
+	return v.Double(offset)
+}
+
+func compareNumbers(a, b float64) int {
+	switch aNaN, bNaN := math.IsNaN(a), math.IsNaN(b); {
+	case aNaN && bNaN:
+		return 0
+	case aNaN:
+		return -1
+	case bNaN:
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: MIT
+
+package bipf_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+func encodeValuer(t testing.TB, v bipf.Valuer) []byte {
+	var buf bytes.Buffer
+	if _, err := v.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompare(t *testing.T) {
+	for i, tc := range []struct {
+		A, B bipf.Valuer
+		Want int
+	}{
+		{bipf.Int32(1), bipf.Int32(2), -1},
+		{bipf.Int32(-1), bipf.Int32(-1), 0},
+		{bipf.Int32(2), bipf.Double(1.5), 1},
+		{bipf.Double(2), bipf.Int32(2), 0},
+		{bipf.Double(math.NaN()), bipf.Double(math.Inf(-1)), -1},
+		{bipf.Double(math.NaN()), bipf.Double(math.NaN()), 0},
+		{bipf.String("abc"), bipf.String("abd"), -1},
+		{bipf.String("ab"), bipf.String("abc"), -1},
+		{bipf.Bytes([]byte{2}), bipf.Bytes([]byte{1, 0}), 1},
+		{bipf.Null(), bipf.Bool(false), -1},
+		{bipf.Bool(true), bipf.Bool(false), 1},
+		{bipf.String("z"), bipf.Bytes(nil), -1},
+		{bipf.Int32(1000), bipf.Bool(false), -1},
+		{bipf.ListOf(bipf.Int32(1), bipf.Int32(10)), bipf.ListOf(bipf.Int32(2)), -1},
+		{bipf.ListOf(bipf.Int32(1)), bipf.ListOf(bipf.Int32(1), bipf.Int32(0)), -1},
+		{bipf.ListOf(bipf.Int32(1), bipf.Double(3)), bipf.ListOf(bipf.Double(1), bipf.Int32(3)), 0},
+		{
+			bipf.MapOf(map[string]bipf.Valuer{"a": bipf.Int32(2)}),
+			bipf.MapOf(map[string]bipf.Valuer{"a": bipf.Int32(1), "b": bipf.Int32(1)}, "a", "b"),
+			1,
+		},
+	} {
+		a, b := encodeValuer(t, tc.A), encodeValuer(t, tc.B)
+
+		got, err := bipf.Compare(a, b)
+		require.NoError(t, err, "case %d", i)
+		require.Equal(t, tc.Want, got, "case %d", i)
+
+		got, err = bipf.Compare(b, a)
+		require.NoError(t, err, "case %d", i)
+		require.Equal(t, -tc.Want, got, "case %d reversed", i)
+	}
+
+	_, err := bipf.Compare([]byte{0x22, 1}, encodeValuer(t, bipf.Int32(1)))
+	require.Error(t, err)
+}
+
+func TestCompareAt(t *testing.T) {
+	r := require.New(t)
+
+	data := testMessageData(t)
+	off, err := bipf.CompilePath("value.timestamp").SeekView(bipf.View(data), 0)
+	r.NoError(err)
+
+	got, err := bipf.CompareAt(data, off, bipf.Double(1618833216123))
+	r.NoError(err)
+	r.Equal(0, got)
+
+	got, err = bipf.CompareAt(data, off, bipf.Int32(math.MaxInt32))
+	r.NoError(err)
+	r.Equal(1, got)
+
+	off, err = bipf.CompilePath("value.author").SeekView(bipf.View(data), 0)
+	r.NoError(err)
+	got, err = bipf.CompareAt(data, off, bipf.String("@B"))
+	r.NoError(err)
+	r.Equal(-1, got)
+}
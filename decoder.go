@@ -1,53 +1,441 @@
 package bipf
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"math"
 
 	"github.com/ssb-ngi-pointer/go-bipf/internal/varint"
 )
 
-var (
-	//  dbg = ioutil.Discard
-	dbg = os.Stderr
-)
-
 // Decoder holds the internal state of the reader portion of the bipf implementation
 type Decoder struct {
 	input io.ReadSeeker
 
 	currentType Type
 	currentLen  uint64
+
+	// valueStart is the offset of the first byte after the current tag
+	valueStart int64
+
+	// tagBuf holds the bytes of the tag while it is read
+	tagBuf [binary.MaxVarintLen64]byte
+
+	// keyBuf is reused to compare object keys while seeking
+	keyBuf []byte
+
+	opts DecoderOptions
+
+	// containerEnds holds the end offsets of the arrays and objects around the current value
+	containerEnds []int64
+
+	// size of the input, -1 until it's needed
+	size int64
+}
+
+// DecoderOptions limit the resources a Decoder uses. The zero value of a field means no limit.
+// Regardless of the options, a value is rejected if its length doesn't fit into the input.
+type DecoderOptions struct {
+	// MaxDepth is the maximum nesting of arrays and objects. A value at the top has depth 1.
+	MaxDepth int
+
+	// MaxValueSize is the maximum length of a string or buffer in bytes
+	MaxValueSize uint64
+
+	// MaxDocumentSize is the maximum length of a value at the top, including its tag.
+	MaxDocumentSize uint64
+
+	// Trace is called for every tag the decoder reads, before it is checked against the limits.
+	// Leave it nil unless you are debugging.
+	Trace func(TraceEvent)
 }
 
-var errTODO = fmt.Errorf("bipf: todo - not implemented")
+// TraceEvent describes a tag the Decoder read
+type TraceEvent struct {
+	// Offset is the position of the tag in the input
+	Offset int64
+
+	Tag    uint64
+	Type   Type
+	Length uint64
+}
 
 // NewDecoder initializes the decoder
 func NewDecoder(rd io.ReadSeeker) *Decoder {
+	return NewDecoderWithOptions(rd, DecoderOptions{})
+}
+
+// NewDecoderWithOptions initializes the decoder with the passed options
+func NewDecoderWithOptions(rd io.ReadSeeker, opts DecoderOptions) *Decoder {
 
 	dec := &Decoder{
 		input:       rd,
 		currentType: typeUninited,
+		size:        -1,
+
+		opts: opts,
 	}
 
 	return dec
 }
 
-// Next advances to the next value
+// Limit names one of the limits of DecoderOptions
+type Limit uint
+
+// These are the limits that can be exceeded
+const (
+	LimitDepth Limit = iota
+	LimitValueSize
+	LimitDocumentSize
+)
+
+func (l Limit) String() string {
+	switch l {
+	case LimitDepth:
+		return "depth"
+	case LimitValueSize:
+		return "value size"
+	case LimitDocumentSize:
+		return "document size"
+	}
+	return fmt.Sprintf("Limit(%d)", uint(l))
+}
+
+// ErrLimitExceeded is returned by the Decoder if a value exceeds one of the limits of its options,
+// and with LimitDepth by the functions that reject values nested deeper than MaxNesting.
+type ErrLimitExceeded struct {
+	Limit Limit
+
+	Max, Got uint64
+}
+
+func (err ErrLimitExceeded) Error() string {
+	return fmt.Sprintf("bipf: maximum %s of %d exceeded: %d", err.Limit, err.Max, err.Got)
+}
+
+// checkTag makes sure the value of the tag that was just read fits into the surrounding arrays and objects
+// and doesn't exceed the limits of the options.
+func (d *Decoder) checkTag(tagStart int64) error {
+	// forget about the arrays and objects that ended before this value
+	for n := len(d.containerEnds); n > 0 && d.containerEnds[n-1] <= tagStart; n-- {
+		d.containerEnds = d.containerEnds[:n-1]
+	}
+
+	// values have to fit into their parent and values at the top into the input,
+	// so that no length read from the input is larger than the input itself
+	var available int64
+	if n := len(d.containerEnds); n > 0 {
+		available = d.containerEnds[n-1] - d.valueStart
+	} else {
+		if max := d.opts.MaxDocumentSize; max > 0 {
+			if size := uint64(d.valueStart-tagStart) + d.currentLen; size > max {
+				return ErrLimitExceeded{Limit: LimitDocumentSize, Max: max, Got: size}
+			}
+		}
+
+		size, err := d.inputSize()
+		if err != nil {
+			return err
+		}
+		available = size - d.valueStart
+	}
+	if available < 0 {
+		return ErrMalformed{Offset: int(tagStart), Reason: "tag doesn't fit into the remaining bytes"}
+	}
+	if d.currentLen > uint64(available) {
+		reason := fmt.Sprintf("%s of length %d doesn't fit into the %d remaining bytes", d.currentType, d.currentLen, available)
+		return ErrMalformed{Offset: int(tagStart), Reason: reason}
+	}
+	valueEnd := d.valueStart + int64(d.currentLen)
+
+	switch d.currentType {
+	case TypeString, TypeBuffer:
+		if max := d.opts.MaxValueSize; max > 0 && d.currentLen > max {
+			return ErrLimitExceeded{Limit: LimitValueSize, Max: max, Got: d.currentLen}
+		}
+
+	case TypeArray, TypeObject:
+		if max := d.opts.MaxDepth; max > 0 && len(d.containerEnds) >= max {
+			return ErrLimitExceeded{Limit: LimitDepth, Max: uint64(max), Got: uint64(len(d.containerEnds) + 1)}
+		}
+		d.containerEnds = append(d.containerEnds, valueEnd)
+	}
+
+	return nil
+}
+
+// inputSize returns the size of the input, which is looked up once
+func (d *Decoder) inputSize() (int64, error) {
+	if d.size >= 0 {
+		return d.size, nil
+	}
+
+	current, err := d.input.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1, fmt.Errorf("bipf: failed to get offset: %w", err)
+	}
+	size, err := d.input.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1, fmt.Errorf("bipf: failed to get input size: %w", err)
+	}
+	if _, err := d.input.Seek(current, io.SeekStart); err != nil {
+		return -1, fmt.Errorf("bipf: failed to seek back: %w", err)
+	}
+
+	d.size = size
+	return size, nil
+}
+
+// Next advances to the next value, in document order.
+// If the current value is an array or an object, the next value is its first entry.
+// Otherwise the rest of the current value is discarded.
+// Use Type() afterwards to read the tag of the next value.
 func (d *Decoder) Next() error {
-	return errTODO
+	var target int64
+	switch d.currentType {
+	case typeUninited:
+		// Type() wasn't called yet, we are already in front of a tag
+		return nil
+
+	case TypeArray, TypeObject:
+		target = d.valueStart
+
+	default:
+		target = d.valueStart + int64(d.currentLen)
+	}
+	return d.seekTo(target)
 }
 
-// Skip discards the current value
+// Skip discards the current value, including all of its entries if it is an array or an object.
+// If Type() wasn't called for the current value, its tag is read first.
 func (d *Decoder) Skip() error {
-	return errTODO
+	if d.currentType == typeUninited {
+		if _, err := d.Type(); err != nil {
+			return err
+		}
+	}
+	return d.seekTo(d.valueStart + int64(d.currentLen))
 }
 
-// SeekToLabel seeks through the stream until it finds a value with that chain of object key names to it
+// seekTo moves the input to the absolute offset and resets the current value.
+func (d *Decoder) seekTo(offset int64) error {
+	_, err := d.input.Seek(offset, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("bipf: failed to seek to %d: %w", offset, err)
+	}
+	d.currentType = typeUninited
+	d.currentLen = 0
+	return nil
+}
+
+// ErrNotFound is returned if a seek didn't find the requested value
+var ErrNotFound = errors.New("bipf: value not found")
+
+// SeekToLabel seeks through the stream until it finds a value with that chain of object key names to it.
+// The names are separated by dots, like "repository.url".
+// Entries of arrays are selected with indexes in brackets, like "mentions[3]" or "branch[0].key".
+// Use SeekToPath if a key contains a dot or brackets.
+// On success the decoder is positioned in front of the value, use Type() to read its tag.
 func (d *Decoder) SeekToLabel(p string) error {
-	return errTODO
+	return d.seekSegments(parsePath(p))
+}
+
+// SeekToPath is like SeekToLabel but takes the chain of object key names as a slice.
+func (d *Decoder) SeekToPath(labels ...string) error {
+	for _, label := range labels {
+		if err := d.seekToKey(label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) seekSegments(segs []pathSegment) error {
+	for _, seg := range segs {
+		var err error
+		if seg.index >= 0 {
+			err = d.SeekToIndex(seg.index)
+		} else {
+			err = d.seekToKey(seg.key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SeekToIndex seeks to entry n of the current array, skipping over the entries before it.
+// On success the decoder is positioned in front of the entry, use Type() to read its tag.
+// If Type() wasn't called for the current value, its tag is read first.
+func (d *Decoder) SeekToIndex(n int) error {
+	end, err := d.enterContainer(TypeArray)
+	if err != nil {
+		return err
+	}
+
+	// step into the array
+	if err := d.Next(); err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		pos, err := d.input.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("bipf: failed to get offset: %w", err)
+		}
+		if pos >= end {
+			return fmt.Errorf("%w: index %d of array with %d entries", ErrNotFound, n, i)
+		}
+
+		if i == n {
+			return nil
+		}
+
+		if err := d.Skip(); err != nil {
+			return err
+		}
+	}
+}
+
+// seekToKey walks the entries of the current object, comparing the raw key bytes
+// and skipping over the values that don't match.
+func (d *Decoder) seekToKey(key string) error {
+	if d.currentType == typeUninited {
+		if _, err := d.Type(); err != nil {
+			return err
+		}
+	}
+
+	if want := TypeObject; d.currentType != want {
+		return ErrUnexpectedType{Want: want, Got: d.currentType}
+	}
+	end := d.valueStart + int64(d.currentLen)
+
+	// step into the object
+	if err := d.Next(); err != nil {
+		return err
+	}
+
+	for {
+		pos, err := d.input.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("bipf: failed to get offset: %w", err)
+		}
+		if pos >= end {
+			return fmt.Errorf("%w: %q", ErrNotFound, key)
+		}
+
+		keyType, err := d.Type()
+		if err != nil {
+			return err
+		}
+		if want := TypeString; keyType != want {
+			return ErrUnexpectedType{Want: want, Got: keyType}
+		}
+
+		keyEnd := d.valueStart + int64(d.currentLen)
+
+		var match bool
+		if d.currentLen == uint64(len(key)) {
+			if cap(d.keyBuf) < len(key) {
+				d.keyBuf = make([]byte, len(key))
+			}
+			d.keyBuf = d.keyBuf[:len(key)]
+
+			_, err = io.ReadFull(d.input, d.keyBuf)
+			if err != nil {
+				return fmt.Errorf("bipf: failed to read key: %w", err)
+			}
+			match = string(d.keyBuf) == key
+		}
+
+		// discard the (rest of the) key
+		if err := d.Skip(); err != nil {
+			return err
+		}
+
+		if match {
+			if keyEnd >= end {
+				return ErrMalformed{Offset: int(pos), Reason: "object key without a value"}
+			}
+			return nil
+		}
+
+		// discard the value
+		if err := d.Skip(); err != nil {
+			return err
+		}
+	}
+}
+
+// seekEncodedKey is like seekToKey, but reads the tag and bytes of each key at once and compares them to encoded
+func (d *Decoder) seekEncodedKey(key string, encoded []byte) error {
+	end, err := d.enterContainer(TypeObject)
+	if err != nil {
+		return err
+	}
+
+	// step into the object
+	if err := d.Next(); err != nil {
+		return err
+	}
+
+	for {
+		pos, err := d.input.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("bipf: failed to get offset: %w", err)
+		}
+		if pos >= end {
+			return fmt.Errorf("%w: %q", ErrNotFound, key)
+		}
+
+		if pos+int64(len(encoded)) <= end {
+			if cap(d.keyBuf) < len(encoded) {
+				d.keyBuf = make([]byte, len(encoded))
+			}
+			d.keyBuf = d.keyBuf[:len(encoded)]
+
+			if _, err := io.ReadFull(d.input, d.keyBuf); err != nil {
+				return fmt.Errorf("bipf: failed to read key: %w", err)
+			}
+
+			if bytes.Equal(d.keyBuf, encoded) {
+				if pos+int64(len(encoded)) == end {
+					return ErrMalformed{Offset: int(pos), Reason: "object key without a value"}
+				}
+
+				// take over the tag of the key, as if Type() read it, and skip to the value
+				tag, n := varint.ConsumeVarint(encoded)
+				if _, err := d.useTag(tag, pos, pos+int64(n)); err != nil {
+					return err
+				}
+				return d.Skip()
+			}
+
+			if err := d.seekTo(pos); err != nil {
+				return err
+			}
+		}
+
+		// not the key, discard it and its value
+		keyType, err := d.Type()
+		if err != nil {
+			return err
+		}
+		if want := TypeString; keyType != want {
+			return ErrUnexpectedType{Want: want, Got: keyType}
+		}
+		if err := d.Skip(); err != nil {
+			return err
+		}
+		if err := d.Skip(); err != nil {
+			return err
+		}
+	}
 }
 
 // Type returns the type of the current value
@@ -56,17 +444,20 @@ func (d *Decoder) Type() (Type, error) {
 	// start with 1 byte and append to it until we get a clean varint
 	var (
 		tag      uint64
-		tagBytes []byte
+		tagBytes = d.tagBuf[:0]
 	)
 
 readTagByte:
 	for {
-		var singleByte = make([]byte, 1)
+		if len(tagBytes) == len(d.tagBuf) {
+			return typeUninited, fmt.Errorf("bipf: broken varint tag field")
+		}
+		singleByte := d.tagBuf[len(tagBytes) : len(tagBytes)+1]
 		_, err := io.ReadFull(d.input, singleByte)
 		if err != nil {
 			return typeUninited, err
 		}
-		tagBytes = append(tagBytes, singleByte[0])
+		tagBytes = d.tagBuf[:len(tagBytes)+1]
 
 		var byteCount int
 		tag, byteCount = varint.ConsumeVarint(tagBytes)
@@ -74,15 +465,22 @@ readTagByte:
 		case byteCount == varint.ErrCodeTruncated:
 			continue readTagByte
 		case byteCount > 0:
-			fmt.Fprintln(dbg, "\tvarint byteCount:", byteCount)
 			break readTagByte // we got a varint!
 		default:
 			return typeUninited, fmt.Errorf("bipf: broken varint tag field")
 		}
 	}
 
-	fmt.Fprintf(dbg, "\tdecoded %x to tag: %d\n", tagBytes, tag)
+	valueStart, err := d.input.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return typeUninited, fmt.Errorf("bipf: failed to get value offset: %w", err)
+	}
+
+	return d.useTag(tag, valueStart-int64(len(tagBytes)), valueStart)
+}
 
+// useTag makes tag, which was read between tagStart and valueStart, the tag of the current value
+func (d *Decoder) useTag(tag uint64, tagStart, valueStart int64) (Type, error) {
 	// apply mask to get type
 	d.currentType = Type(tag & tagMask)
 	if d.currentType >= TypeReserved {
@@ -91,23 +489,57 @@ readTagByte:
 
 	// shift right to get length
 	d.currentLen = uint64(tag >> tagSize)
+	d.valueStart = valueStart
+
+	if d.opts.Trace != nil {
+		d.opts.Trace(TraceEvent{
+			Offset: tagStart,
+			Tag:    tag,
+			Type:   d.currentType,
+			Length: d.currentLen,
+		})
+	}
 
-	// drop some debugging info
-	fmt.Fprintln(dbg, "\tvalue type:", d.currentType)
-	fmt.Fprintln(dbg, "\tvalue length:", d.currentLen)
-	fmt.Fprintln(dbg)
-	dbg.Sync()
+	if err := d.checkTag(tagStart); err != nil {
+		d.currentType = typeUninited
+		return typeUninited, err
+	}
 
 	return d.currentType, nil
 }
 
-// Bool returns the value if the current type is a bool
+// ErrNull is returned by Bool if the value is null instead of true or false
+var ErrNull = errors.New("bipf: value is null")
+
+// IsNull returns true if the current value is null
+func (d *Decoder) IsNull() bool {
+	return d.currentType == TypeBool && d.currentLen == 0
+}
+
+// Null returns an error if the current value isn't null
+func (d *Decoder) Null() error {
+	if want := TypeBool; d.currentType != want {
+		return ErrUnexpectedType{Want: want, Got: d.currentType}
+	}
+
+	if d.currentLen != 0 {
+		return fmt.Errorf("bipf/null: expected 0 bytes of value, not %d", d.currentLen)
+	}
+	return nil
+}
+
+// Bool returns the value if the current type is a bool.
+// If the value is null it returns ErrNull.
 func (d *Decoder) Bool() (bool, error) {
 	if want := TypeBool; d.currentType != want {
 		return false, ErrUnexpectedType{Want: want, Got: d.currentType}
 	}
 
-	if d.currentLen != 1 {
+	switch d.currentLen {
+	case 0:
+		return false, ErrNull
+	case 1:
+	default:
 		return false, fmt.Errorf("bipf/bool: expected 1 bytes of value, not %d", d.currentLen)
 	}
 
@@ -134,9 +566,6 @@ func (d *Decoder) CopyString() (string, error) {
 		return "", ErrUnexpectedType{Want: want, Got: d.currentType}
 	}
 
-	// maybe we want some max size?
-	// if d.currentLen > ??? { ... }
-
 	var valueBuffer = make([]byte, d.currentLen)
 	_, err := io.ReadFull(d.input, valueBuffer)
 	if err != nil {
@@ -146,26 +575,49 @@ func (d *Decoder) CopyString() (string, error) {
 	return string(valueBuffer), nil
 }
 
+// CopyBytes returns a copy of the value if the current type is a buffer
+func (d *Decoder) CopyBytes() ([]byte, error) {
+	if want := TypeBuffer; d.currentType != want {
+		return nil, ErrUnexpectedType{Want: want, Got: d.currentType}
+	}
+
+	var valueBuffer = make([]byte, d.currentLen)
+	_, err := io.ReadFull(d.input, valueBuffer)
+	if err != nil {
+		return nil, fmt.Errorf("bipf/buffer: failed to read value: %w", err)
+	}
+
+	return valueBuffer, nil
+}
+
+// BytesReader returns a reader for the value if the current type is a buffer.
+// It reads directly from the input and stops at the end of the value.
+// The reader is only valid until the decoder is used again.
+func (d *Decoder) BytesReader() (io.Reader, error) {
+	if want := TypeBuffer; d.currentType != want {
+		return nil, ErrUnexpectedType{Want: want, Got: d.currentType}
+	}
+
+	return io.LimitReader(d.input, int64(d.currentLen)), nil
+}
+
 // Double returns the floating-point value if the current type is a double
 func (d *Decoder) Double() (float64, error) {
 	if want := TypeDouble; d.currentType != want {
 		return -1, ErrUnexpectedType{Want: want, Got: d.currentType}
 	}
 
-	if d.currentLen == 0 {
-		return 0, nil
+	if d.currentLen != 8 {
+		return -1, fmt.Errorf("bipf/double: expected 8 bytes of value, not %d", d.currentLen)
 	}
 
-	// just read 4 bytes of input
-	limit := io.LimitReader(d.input, 4)
-
-	var iv float64
-	err := binary.Read(limit, binary.LittleEndian, &iv)
+	var valueBytes [8]byte
+	_, err := io.ReadFull(d.input, valueBytes[:])
 	if err != nil {
-		return -1, fmt.Errorf("bipf/double: failed to decode value: %w", err)
+		return -1, fmt.Errorf("bipf/double: failed to read value: %w", err)
 	}
 
-	return iv, nil
+	return math.Float64frombits(binary.LittleEndian.Uint64(valueBytes[:])), nil
 }
 
 // Int32 returns a the 32bit integer value if the current type is a integer
@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -21,7 +25,7 @@ func TestSimple(t *testing.T) {
 	var i int32 = 10
 	for ; i > 0; i-- {
 		ival := bipf.Int32(i)
-		err := ival(b)
+		_, err := ival.WriteTo(b)
 		r.NoError(err)
 	}
 
@@ -30,16 +34,7 @@ func TestSimple(t *testing.T) {
 }
 
 func TestFixtures(t *testing.T) {
-	r := require.New(t)
-
-	b, err := ioutil.ReadFile("./fixtures.json")
-	r.NoError(err)
-
-	var lst []tspec
-	err = json.Unmarshal(b, &lst)
-	r.NoError(err)
-
-	for i, ts := range lst {
+	for i, ts := range loadFixtures(t) {
 		t.Run(ts.Name, runFixtures(i, ts))
 	}
 }
@@ -69,7 +64,7 @@ func runFixtures(i int, ts tspec) func(t *testing.T) {
 			r.True(ok, "case%d: not number data, %T", i, iv)
 			wantv := int32(fv)
 
-			err = bipf.Int32(wantv)(b)
+			_, err = bipf.Int32(wantv).WriteTo(b)
 			r.NoError(err, "case%d: didnt encode", i)
 
 			a.Equal(wantData, b.Bytes(), "case%d: wrong encoded data", i)
@@ -85,12 +80,14 @@ func runFixtures(i int, ts tspec) func(t *testing.T) {
 			wantv, ok := iv.(bool)
 			r.True(ok, "case%d: not bool data, %T", i, iv)
 
-			err = bipf.Bool(wantv)(b)
+			_, err = bipf.Bool(wantv).WriteTo(b)
 			r.NoError(err, "case%d: didnt encode", i)
 
 			a.Equal(wantData, b.Bytes(), "case%d: wrong encoded data", i)
 
 			r.Equal(bipf.TypeBool, dect)
+			a.False(dec.IsNull(), "case%d: unexpected null", i)
+			a.Error(dec.Null(), "case%d: unexpected null", i)
 			decval, err := dec.Bool()
 			if !a.NoError(err, "case%d: didnt get int", i) {
 				return
@@ -100,8 +97,17 @@ func runFixtures(i int, ts tspec) func(t *testing.T) {
 		case i == 6: // null literal
 			r.True(iv == nil, "case%d: not ??? data, %T %v", i, iv, iv)
 
-			t.Error("TODO: type Null?")
+			_, err = bipf.Null().WriteTo(b)
+			r.NoError(err, "case%d: didnt encode", i)
+
+			a.Equal(wantData, b.Bytes(), "case%d: wrong encoded data", i)
+
 			r.Equal(bipf.TypeBool, dect, "unexpected type: %s", dect)
+			a.True(dec.IsNull(), "case%d: not null", i)
+			a.NoError(dec.Null(), "case%d: not null", i)
+
+			_, err = dec.Bool()
+			a.Equal(bipf.ErrNull, err, "case%d: expected null error", i)
 
 		case i == 8: // empty array
 			r.Equal(bipf.TypeArray, dect, "unexpected type: %s", dect)
@@ -130,7 +136,7 @@ func runFixtures(i int, ts tspec) func(t *testing.T) {
 			str, ok := iv.(string)
 			r.True(ok, "case%d: not string data, %T", i, iv)
 
-			err = bipf.String(str)(b)
+			_, err = bipf.String(str).WriteTo(b)
 			r.NoError(err, "case%d: didnt encode", i)
 
 			a.Equal(wantData, b.Bytes(), "case%d: wrong encoded data", i)
@@ -158,7 +164,46 @@ func runFixtures(i int, ts tspec) func(t *testing.T) {
 
 		case i == 13: // [-1, {foo: true}, []byte{222,173,190,239} ]
 			r.Equal(bipf.TypeArray, dect, "unexpected type: %s", dect)
-			// TODO: value comparisons
+
+			wantBuf := []byte{222, 173, 190, 239}
+			_, err = bipf.ListOf(
+				bipf.Int32(-1),
+				bipf.MapOf(map[string]bipf.Valuer{"foo": bipf.Bool(true)}),
+				bipf.Bytes(wantBuf),
+			).WriteTo(b)
+			r.NoError(err, "case%d: didnt encode", i)
+			a.Equal(wantData, b.Bytes(), "case%d: wrong encoded data", i)
+
+			dt, err := dec.Type()
+			r.NoError(err)
+			r.Equal(bipf.TypeInt32, dt)
+			deci, err := dec.Int32()
+			r.NoError(err)
+			a.EqualValues(-1, deci)
+
+			r.NoError(dec.Next())
+			r.NoError(dec.SeekToLabel("foo"))
+			dt, err = dec.Type()
+			r.NoError(err)
+			r.Equal(bipf.TypeBool, dt)
+			r.NoError(dec.Skip())
+
+			dt, err = dec.Type()
+			r.NoError(err)
+			r.Equal(bipf.TypeBuffer, dt)
+			decbuf, err := dec.CopyBytes()
+			r.NoError(err)
+			a.Equal(wantBuf, decbuf)
+
+			// the same without copying
+			v := bipf.View(wantData)
+			off, err := v.Skip(2)
+			r.NoError(err)
+			off, err = v.Skip(off)
+			r.NoError(err)
+			viewBuf, err := v.Buffer(off)
+			r.NoError(err)
+			a.Equal(wantBuf, viewBuf)
 
 		case i == 14: // package.json
 			r.Equal(bipf.TypeObject, dect, "unexpected type: %s", dect)
@@ -174,16 +219,44 @@ func runFixtures(i int, ts tspec) func(t *testing.T) {
 
 			descr, err := dec.CopyString()
 			r.NoError(err)
-			wantString := pkgMap["descriptipn"].(string)
+			wantString := pkgMap["description"].(string)
 			a.Equal(wantString, descr)
 
-			// TODO: more value comparisons
+			for _, path := range [][]string{
+				{"devDependencies", "tape"},
+				{"repository", "url"},
+				{"scripts", "test"},
+			} {
+				dec = bipf.NewDecoder(bytes.NewReader(wantData))
+
+				err = dec.SeekToLabel(strings.Join(path, "."))
+				r.NoError(err, "failed to seek to %v", path)
+
+				dt, err := dec.Type()
+				r.NoError(err)
+				a.Equal(bipf.TypeString, dt, "got type: %s", dt)
+
+				got, err := dec.CopyString()
+				r.NoError(err)
+
+				var want interface{} = pkgMap
+				for _, label := range path {
+					want = want.(map[string]interface{})[label]
+				}
+				a.Equal(want, got)
 
-			// SeekToLabel("devDependencies.tape")
+				// the same via a slice of labels
+				dec = bipf.NewDecoder(bytes.NewReader(wantData))
+				r.NoError(dec.SeekToPath(path...))
+			}
 
-			// Reset() ?
+			dec = bipf.NewDecoder(bytes.NewReader(wantData))
+			err = dec.SeekToLabel("devDependencies.nope")
+			a.True(errors.Is(err, bipf.ErrNotFound), "unexpected error: %v", err)
 
-			// SeekToLabel("repository.url")
+			dec = bipf.NewDecoder(bytes.NewReader(wantData))
+			err = dec.SeekToLabel("name.nope")
+			a.Error(err)
 
 		case i == 15: // {1: true}
 			r.Equal(bipf.TypeObject, dect, "unexpected type: %s", dect)
@@ -202,6 +275,16 @@ func runFixtures(i int, ts tspec) func(t *testing.T) {
 	}
 }
 
+// loadFixtures reads the test vectors from fixtures.json
+func loadFixtures(t testing.TB) []tspec {
+	b, err := ioutil.ReadFile("./fixtures.json")
+	require.NoError(t, err)
+
+	var lst []tspec
+	require.NoError(t, json.Unmarshal(b, &lst))
+	return lst
+}
+
 type tspec struct {
 	Name   string
 	JSON   hexJSON
@@ -235,6 +318,7 @@ func (s hexBytes) Data() []byte {
 }
 
 type hexJSON struct {
+	raw []byte
 	val interface{}
 }
 
@@ -255,6 +339,244 @@ func (s *hexJSON) UnmarshalJSON(data []byte) error {
 	if err != nil {
 		return fmt.Errorf("invalid hexJSON: %w", err)
 	}
+	s.raw = bts
 	s.val = newv
 	return nil
 }
+
+func TestDecoderNextAndSkip(t *testing.T) {
+	r := require.New(t)
+
+	// [-1, {foo: true}, deadbeef]
+	data, err := hex.DecodeString("8c0122ffffffff3518666f6f0e0121deadbeef")
+	r.NoError(err)
+
+	// Next walks every value in document order
+	dec := bipf.NewDecoder(bytes.NewReader(data))
+	var types []bipf.Type
+	for {
+		r.NoError(dec.Next())
+		typ, err := dec.Type()
+		if err == io.EOF {
+			break
+		}
+		r.NoError(err)
+		types = append(types, typ)
+	}
+	r.Equal([]bipf.Type{
+		bipf.TypeArray,
+		bipf.TypeInt32,
+		bipf.TypeObject, bipf.TypeString, bipf.TypeBool,
+		bipf.TypeBuffer,
+	}, types)
+
+	// Skip jumps over the object
+	dec = bipf.NewDecoder(bytes.NewReader(data))
+	typ, err := dec.Type()
+	r.NoError(err)
+	r.Equal(bipf.TypeArray, typ)
+	r.NoError(dec.Next())
+
+	r.NoError(dec.Skip()) // -1
+
+	typ, err = dec.Type()
+	r.NoError(err)
+	r.Equal(bipf.TypeObject, typ)
+	r.NoError(dec.Skip())
+
+	typ, err = dec.Type()
+	r.NoError(err)
+	r.Equal(bipf.TypeBuffer, typ)
+	r.NoError(dec.Skip())
+
+	_, err = dec.Type()
+	r.Equal(io.EOF, err)
+}
+
+func TestDecoderBytesReader(t *testing.T) {
+	r := require.New(t)
+
+	var b = &bytes.Buffer{}
+	_, err := bipf.ListOf(
+		bipf.Bytes([]byte("some blob data")),
+		bipf.Bytes(nil),
+		bipf.Bool(true),
+	).WriteTo(b)
+	r.NoError(err)
+
+	dec := bipf.NewDecoder(bytes.NewReader(b.Bytes()))
+	r.NoError(dec.Skip())
+	_, err = dec.Type()
+	r.Equal(io.EOF, err)
+
+	dec = bipf.NewDecoder(bytes.NewReader(b.Bytes()))
+	_, err = dec.Type()
+	r.NoError(err)
+	r.NoError(dec.Next())
+
+	dt, err := dec.Type()
+	r.NoError(err)
+	r.Equal(bipf.TypeBuffer, dt)
+
+	rd, err := dec.BytesReader()
+	r.NoError(err)
+	blob, err := ioutil.ReadAll(rd)
+	r.NoError(err)
+	r.Equal("some blob data", string(blob))
+
+	dt, err = dec.Type()
+	r.NoError(err)
+	r.Equal(bipf.TypeBuffer, dt)
+	empty, err := dec.CopyBytes()
+	r.NoError(err)
+	r.Len(empty, 0)
+
+	dt, err = dec.Type()
+	r.NoError(err)
+	r.Equal(bipf.TypeBool, dt)
+	_, err = dec.CopyBytes()
+	r.Equal(bipf.ErrUnexpectedType{Want: bipf.TypeBuffer, Got: bipf.TypeBool}, err)
+}
+
+// TestDoubleFixtures checks doubles against the output of the JS implementation (buffer.writeDoubleLE)
+func TestDoubleFixtures(t *testing.T) {
+	for _, tc := range []struct {
+		Name  string
+		Value float64
+		Hex   string
+	}{
+		{"half", 0.5, "43000000000000e03f"},
+		{"23.42", 23.42, "43ec51b81e856b3740"},
+		{"negative", -0.001, "43fca9f1d24d6250bf"},
+		{"NaN", math.Float64frombits(0x7ff8000000000000), "43000000000000f87f"},
+		{"+Inf", math.Inf(1), "43000000000000f07f"},
+		{"-Inf", math.Inf(-1), "43000000000000f0ff"},
+		{"-0", math.Copysign(0, -1), "430000000000000080"},
+		{"smallest subnormal", math.SmallestNonzeroFloat64, "430100000000000000"},
+		{"largest subnormal", math.Float64frombits(0x000fffffffffffff), "43ffffffffffff0f00"},
+		{"max", math.MaxFloat64, "43ffffffffffffef7f"},
+	} {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			var b = &bytes.Buffer{}
+			_, err := bipf.Double(tc.Value).WriteTo(b)
+			r.NoError(err)
+			r.Equal(tc.Hex, hex.EncodeToString(b.Bytes()))
+
+			dec := bipf.NewDecoder(bytes.NewReader(b.Bytes()))
+			dt, err := dec.Type()
+			r.NoError(err)
+			r.Equal(bipf.TypeDouble, dt)
+
+			got, err := dec.Double()
+			r.NoError(err)
+			r.Equal(math.Float64bits(tc.Value), math.Float64bits(got))
+
+			got, err = bipf.View(b.Bytes()).Double(0)
+			r.NoError(err)
+			r.Equal(math.Float64bits(tc.Value), math.Float64bits(got))
+		})
+	}
+
+	// payloads of NaNs are kept
+	var b = &bytes.Buffer{}
+	_, err := bipf.Double(math.NaN()).WriteTo(b)
+	require.NoError(t, err)
+	got, err := bipf.View(b.Bytes()).Double(0)
+	require.NoError(t, err)
+	require.Equal(t, math.Float64bits(math.NaN()), math.Float64bits(got))
+
+	// wrong length
+	dec := bipf.NewDecoder(bytes.NewReader([]byte{0x23, 0, 0, 0, 0}))
+	_, err = dec.Type()
+	require.NoError(t, err)
+	_, err = dec.Double()
+	require.Error(t, err)
+}
+
+func TestDecoderLimits(t *testing.T) {
+	r := require.New(t)
+
+	var b = &bytes.Buffer{}
+	_, err := bipf.ListOf(
+		bipf.ListOf(bipf.ListOf(bipf.Int32(1))),
+		bipf.String("some longer string"),
+	).WriteTo(b)
+	r.NoError(err)
+	data := b.Bytes()
+
+	walk := func(opts bipf.DecoderOptions) error {
+		dec := bipf.NewDecoderWithOptions(bytes.NewReader(data), opts)
+		for {
+			if err := dec.Next(); err != nil {
+				return err
+			}
+			if _, err := dec.Type(); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+
+	r.NoError(walk(bipf.DecoderOptions{}))
+	r.NoError(walk(bipf.DecoderOptions{MaxDepth: 3, MaxValueSize: 18, MaxDocumentSize: uint64(len(data))}))
+
+	for _, tc := range []struct {
+		Opts bipf.DecoderOptions
+		Want bipf.ErrLimitExceeded
+	}{
+		{bipf.DecoderOptions{MaxDepth: 2}, bipf.ErrLimitExceeded{Limit: bipf.LimitDepth, Max: 2, Got: 3}},
+		{bipf.DecoderOptions{MaxValueSize: 10}, bipf.ErrLimitExceeded{Limit: bipf.LimitValueSize, Max: 10, Got: 18}},
+		{bipf.DecoderOptions{MaxDocumentSize: 10}, bipf.ErrLimitExceeded{Limit: bipf.LimitDocumentSize, Max: 10, Got: uint64(len(data))}},
+	} {
+		err := walk(tc.Opts)
+		r.Equal(tc.Want, err, "%+v", tc.Opts)
+	}
+
+	// a string claiming more bytes than the array around it holds is rejected before it is read
+	malformed := []byte{0x14, 0xf8, 0xff, 0xff, 0xff, 0x0f}
+	dec := bipf.NewDecoder(bytes.NewReader(malformed))
+	_, err = dec.Type()
+	r.NoError(err)
+	_, err = dec.Type()
+	var malformedErr bipf.ErrMalformed
+	r.True(errors.As(err, &malformedErr), "unexpected error: %v", err)
+	r.Equal(1, malformedErr.Offset)
+
+	// so is a value claiming more bytes than the input has, without any limits set
+	huge := []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x08}
+	dec = bipf.NewDecoder(bytes.NewReader(huge))
+	_, err = dec.Type()
+	r.True(errors.As(err, &malformedErr), "unexpected error: %v", err)
+	_, err = dec.CopyString()
+	r.Error(err)
+}
+
+func TestDecoderTrace(t *testing.T) {
+	r := require.New(t)
+
+	// {foo: true}
+	data, err := hex.DecodeString("3518666f6f0e01")
+	r.NoError(err)
+
+	var events []bipf.TraceEvent
+	dec := bipf.NewDecoderWithOptions(bytes.NewReader(data), bipf.DecoderOptions{
+		Trace: func(evt bipf.TraceEvent) {
+			events = append(events, evt)
+		},
+	})
+
+	r.NoError(dec.SeekToLabel("foo"))
+	_, err = dec.Type()
+	r.NoError(err)
+
+	r.Equal([]bipf.TraceEvent{
+		{Offset: 0, Tag: 0x35, Type: bipf.TypeObject, Length: 6},
+		{Offset: 1, Tag: 0x18, Type: bipf.TypeString, Length: 3},
+		{Offset: 5, Tag: 0x0e, Type: bipf.TypeBool, Length: 1},
+	}, events)
+}
@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: MIT
+
+package bipf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/ssb-ngi-pointer/go-bipf/internal/varint"
+)
+
+// dumpPreviewSize is the maximum number of bytes shown for strings, buffers and malformed regions
+const dumpPreviewSize = 16
+
+// Dump writes an annotated listing of the encoded data to w.
+//
+// Every value gets a line with its offset, the bytes of its tag, the decoded tag, its type and length.
+// Entries of arrays and objects are indented below them. Malformed parts of the data are flagged
+// and skipped up to the end of the surrounding value, so that the rest of the data can still be inspected.
+// Arrays and objects nested deeper than MaxNesting are flagged instead of listed.
+// The returned error is only about writing to w.
+func Dump(w io.Writer, data []byte) error {
+	d := dumper{w: w, data: data}
+	d.values(0, len(data), 0, false)
+	return d.err
+}
+
+type dumper struct {
+	w    io.Writer
+	data []byte
+
+	// err is the first error returned by w
+	err error
+}
+
+func (d *dumper) printf(format string, args ...interface{}) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = fmt.Fprintf(d.w, format, args...)
+}
+
+// values dumps all values between start and end
+func (d *dumper) values(start, end, depth int, isObject bool) {
+	var count int
+	for pos := start; pos < end; count++ {
+		isKey := isObject && count%2 == 0
+		pos = d.value(pos, end, depth, isKey)
+	}
+	if isObject && count%2 != 0 {
+		d.flag(end, depth, "object has a key without a value")
+	}
+}
+
+// value dumps the value at offset, which has to end before end, and returns the offset after it
+func (d *dumper) value(offset, end, depth int, isKey bool) int {
+	tag, tagLen := varint.ConsumeVarint(d.data[offset:end])
+	if tagLen < 0 {
+		d.malformed(offset, end, depth, "broken varint tag field")
+		return end
+	}
+
+	var (
+		tagBytes = d.data[offset : offset+tagLen]
+		typ      = Type(tag & tagMask)
+		length   = tag >> tagSize
+		start    = offset + tagLen
+	)
+
+	if typ >= TypeReserved {
+		d.malformed(offset, end, depth, fmt.Sprintf("invalid type %s in tag %d", typ, tag))
+		return end
+	}
+
+	if length > uint64(end-start) {
+		d.malformed(offset, end, depth, fmt.Sprintf("%s of length %d doesn't fit into the %d remaining bytes", typ, length, end-start))
+		return end
+	}
+	valueEnd := start + int(length)
+
+	if err := checkNesting(typ, depth+1); err != nil {
+		d.malformed(offset, valueEnd, depth, fmt.Sprintf("%s nested deeper than %d", typ, MaxNesting))
+		return valueEnd
+	}
+
+	d.printf("%08x  %-14s  %*s%s len=%d tag=%d", offset, fmt.Sprintf("% x", tagBytes), depth*2, "", typ, length, tag)
+	if isKey && typ != TypeString {
+		d.printf(" !! object key is not a string")
+	}
+	d.printf("%s\n", describe(typ, d.data[start:valueEnd]))
+
+	if typ == TypeArray || typ == TypeObject {
+		d.values(start, valueEnd, depth+1, typ == TypeObject)
+	}
+
+	return valueEnd
+}
+
+// malformed flags the region between offset and end
+func (d *dumper) malformed(offset, end, depth int, reason string) {
+	region := d.data[offset:end]
+	var more string
+	if len(region) > dumpPreviewSize {
+		region = region[:dumpPreviewSize]
+		more = "..."
+	}
+	d.flag(offset, depth, fmt.Sprintf("malformed: %s (%d bytes: %x%s)", reason, end-offset, region, more))
+}
+
+// flag writes a line about a problem at offset
+func (d *dumper) flag(offset, depth int, msg string) {
+	d.printf("%08x  %-14s  %*s!! %s\n", offset, "", depth*2, "", msg)
+}
+
+// describe returns a short description of the value for the listing
+func describe(typ Type, value []byte) string {
+	switch typ {
+	case TypeString:
+		if len(value) > dumpPreviewSize {
+			return " " + strconv.Quote(string(value[:dumpPreviewSize])) + "..."
+		}
+		return " " + strconv.Quote(string(value))
+
+	case TypeBuffer:
+		if len(value) > dumpPreviewSize {
+			return fmt.Sprintf(" %x...", value[:dumpPreviewSize])
+		}
+		return fmt.Sprintf(" %x", value)
+
+	case TypeInt32:
+		if len(value) != 4 {
+			return " !! expected 4 bytes of value"
+		}
+		return fmt.Sprintf(" %d", int32(binary.LittleEndian.Uint32(value)))
+
+	case TypeDouble:
+		if len(value) != 8 {
+			return " !! expected 8 bytes of value"
+		}
+		return " " + strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(value)), 'g', -1, 64)
+
+	case TypeBool:
+		switch {
+		case len(value) == 0:
+			return " null"
+		case len(value) != 1:
+			return " !! expected 0 or 1 bytes of value"
+		case value[0] == 0:
+			return " false"
+		case value[0] == 1:
+			return " true"
+		default:
+			return fmt.Sprintf(" !! invalid bool value %d", value[0])
+		}
+	}
+	return ""
+}
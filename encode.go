@@ -3,7 +3,6 @@
 package bipf
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -34,162 +33,237 @@ const (
 	tagMask = 7
 )
 
-type Valuer func(io.Writer) error
+// Valuer is a value that can be encoded.
+// Its encoded size is known up front, so that arrays and objects can write their tags
+// before their entries and the whole value is written to the destination in one pass.
+type Valuer interface {
+	// EncodedSize returns the number of bytes WriteTo writes, including the tag
+	EncodedSize() int
+
+	io.WriterTo
+}
+
+// tagged returns the size of a value with a tag in front of it
+func tagged(length int) int {
+	return varint.SizeVarint(uint64(length)<<tagSize) + length
+}
+
+// writeTag writes the tag for a value of type t and the given length
+func writeTag(w io.Writer, t Type, length int) (int64, error) {
+	var buf [binary.MaxVarintLen64]byte
+	n, err := w.Write(appendTag(buf[:0], t, length))
+	return int64(n), err
+}
+
+type stringValue string
 
 // String encodes type 1
 // TODO: unicode!?
-func String(v string) Valuer {
-	return func(w io.Writer) error {
-		var err error
-		if len(v) == 0 {
-			_, err = w.Write([]byte{byte(TypeString)})
-			return err
-		}
+func String(v string) Valuer { return stringValue(v) }
 
-		strlen := len(v)
-		tag := Type(strlen<<tagSize) | TypeString
+func (v stringValue) EncodedSize() int { return tagged(len(v)) }
 
-		err = varint.WriteVarint(w, uint64(tag))
-		if err != nil {
-			return err
-		}
-		n, err := w.Write([]byte(v))
-		if err != nil {
-			return err
-		}
-		if n != strlen {
-			return fmt.Errorf("short write. %d vs %d", n, strlen)
-		}
-		return nil
+func (v stringValue) WriteTo(w io.Writer) (int64, error) {
+	n, err := writeTag(w, TypeString, len(v))
+	if err != nil || len(v) == 0 {
+		return n, err
 	}
+	m, err := io.WriteString(w, string(v))
+	return n + int64(m), err
 }
 
-func Bytes([]byte) Valuer {
-	return func(w io.Writer) error {
-		err := fmt.Errorf("TODO: Bytes()")
-		return err
+type bytesValue []byte
+
+// Bytes encodes the passed slice as a buffer
+func Bytes(v []byte) Valuer { return bytesValue(v) }
+
+func (v bytesValue) EncodedSize() int { return tagged(len(v)) }
+
+func (v bytesValue) WriteTo(w io.Writer) (int64, error) {
+	n, err := writeTag(w, TypeBuffer, len(v))
+	if err != nil || len(v) == 0 {
+		return n, err
 	}
+	m, err := w.Write(v)
+	return n + int64(m), err
 }
 
-func Int32(v int32) Valuer {
-	return func(w io.Writer) error {
-		_, err := w.Write([]byte{0x22})
-		if err != nil {
-			return err
-		}
-		err = binary.Write(w, binary.LittleEndian, v)
-		return err
-	}
+type int32Value int32
+
+func Int32(v int32) Valuer { return int32Value(v) }
+
+func (v int32Value) EncodedSize() int { return 5 }
+
+func (v int32Value) WriteTo(w io.Writer) (int64, error) {
+	var buf [5]byte
+	n, err := w.Write(AppendInt32(buf[:0], int32(v)))
+	return int64(n), err
 }
-func Double(v float64) Valuer {
-	return func(w io.Writer) error {
-		_, err := w.Write([]byte{0x43})
-		if err != nil {
-			return err
-		}
-		err = binary.Write(w, binary.LittleEndian, v)
-		return err
-	}
+
+type doubleValue float64
+
+// Double encodes a 64bit float.
+// The bits of the value are kept as they are, including the payload of NaNs.
+func Double(v float64) Valuer { return doubleValue(v) }
+
+func (v doubleValue) EncodedSize() int { return 9 }
+
+func (v doubleValue) WriteTo(w io.Writer) (int64, error) {
+	var buf [9]byte
+	n, err := w.Write(AppendDouble(buf[:0], float64(v)))
+	return int64(n), err
+}
+
+type mapValue struct {
+	keys   []string
+	values []Valuer
+	size   int // of the entries, without the tag
+
+	// err is a problem with the passed order, returned when writing
+	err error
 }
 
 // MapOf encodes the passed map as an object.
 // If the order of the fields is important, these can be passed as variadic list of strings.
 // If it's passed it needs to have the same length as the number of keys in the map.
+// Without an order the keys are written in the random order of the map, wrap it in Canonical to sort them.
+// Values in m are encoded with the content they have when MapOf is called.
 func MapOf(m map[string]Valuer, order ...string) Valuer {
-	return func(w io.Writer) error {
-		if len(order) > 0 && len(order) != len(m) {
-			return fmt.Errorf("map and orderd field size differ")
-		}
-
-		var buf bytes.Buffer
+	if len(order) > 0 && len(order) != len(m) {
+		return &mapValue{err: fmt.Errorf("map and orderd field size differ")}
+	}
 
-		var keys = make([]string, len(m))
-		if len(order) == 0 {
-			// no order, just pick any
-			i := 0
-			for k := range m {
-				keys[i] = k
-				i++
-			}
-		} else {
-			for i, k := range order {
-				if _, has := m[k]; !has {
-					return fmt.Errorf("orderd field %q not in map", k)
-				}
-				keys[i] = k
+	var keys = make([]string, len(m))
+	if len(order) == 0 {
+		// no order, just pick any
+		i := 0
+		for k := range m {
+			keys[i] = k
+			i++
+		}
+	} else {
+		for i, k := range order {
+			if _, has := m[k]; !has {
+				return &mapValue{err: fmt.Errorf("orderd field %q not in map", k)}
 			}
+			keys[i] = k
 		}
+	}
 
-		for _, k := range keys {
-			v := m[k]
+	values := make([]Valuer, len(keys))
+	for i, k := range keys {
+		values[i] = m[k]
+	}
+	return objectOf(keys, values)
+}
 
-			if err := String(k)(&buf); err != nil {
-				return fmt.Errorf("map encoding failed during key(%q): %w", k, err)
-			}
+// objectOf encodes the keys and values as an object, in the passed order and allowing repeated keys
+func objectOf(keys []string, values []Valuer) *mapValue {
+	mv := &mapValue{keys: keys, values: frozen(values)}
+	for i, k := range keys {
+		mv.size += tagged(len(k)) + mv.values[i].EncodedSize()
+	}
+	return mv
+}
 
-			if err := v(&buf); err != nil {
-				return fmt.Errorf("map encoding failed at value for key(%q): %w", k, err)
-			}
+func (mv *mapValue) EncodedSize() int { return tagged(mv.size) }
 
-		}
-		objSize := buf.Len()
-		tag := Type(objSize<<tagSize) | TypeObject
-		err := varint.WriteVarint(w, uint64(tag))
+func (mv *mapValue) WriteTo(w io.Writer) (int64, error) {
+	if mv.err != nil {
+		return 0, mv.err
+	}
+
+	n, err := writeTag(w, TypeObject, mv.size)
+	if err != nil {
+		return n, err
+	}
+
+	for i, k := range mv.keys {
+		m, err := stringValue(k).WriteTo(w)
+		n += m
 		if err != nil {
-			return err
+			return n, fmt.Errorf("map encoding failed during key(%q): %w", k, err)
 		}
 
-		n, err := buf.WriteTo(w)
+		m, err = mv.values[i].WriteTo(w)
+		n += m
 		if err != nil {
-			return err
+			return n, fmt.Errorf("map encoding failed at value for key(%q): %w", k, err)
 		}
+	}
+	return n, nil
+}
 
-		if int(n) != objSize {
-			return fmt.Errorf("short write. %d vs %d", n, objSize)
-		}
+type listValue struct {
+	items []Valuer
+	size  int // of the items, without the tag
+}
 
-		return nil
+// ListOf encodes the items as an array.
+// Values among them are encoded with the content they have when ListOf is called.
+func ListOf(items ...Valuer) Valuer {
+	lv := &listValue{items: frozen(items)}
+	for _, item := range lv.items {
+		lv.size += item.EncodedSize()
 	}
+	return lv
 }
 
-func ListOf(items ...Valuer) Valuer {
-	return func(w io.Writer) error {
-		var buf bytes.Buffer
+func (lv *listValue) EncodedSize() int { return tagged(lv.size) }
 
-		for idx, item := range items {
-			err := item(&buf)
-			if err != nil {
-				return fmt.Errorf("list failed to encode item %d: %w", idx, err)
-			}
-		}
+func (lv *listValue) WriteTo(w io.Writer) (int64, error) {
+	n, err := writeTag(w, TypeArray, lv.size)
+	if err != nil {
+		return n, err
+	}
 
-		arrSize := buf.Len()
-		tag := Type(arrSize<<tagSize) | TypeArray
-		err := varint.WriteVarint(w, uint64(tag))
+	for idx, item := range lv.items {
+		m, err := item.WriteTo(w)
+		n += m
 		if err != nil {
-			return err
+			return n, fmt.Errorf("list failed to encode item %d: %w", idx, err)
 		}
+	}
+	return n, nil
+}
 
-		n, err := buf.WriteTo(w)
-		if err != nil {
-			return err
+// frozen replaces the Values in vals with their current content, so that changing them later
+// doesn't break the sizes computed from them. The passed slice is copied before it's changed.
+func frozen(vals []Valuer) []Valuer {
+	copied := false
+	for i, v := range vals {
+		tv, ok := v.(*Value)
+		if !ok {
+			continue
 		}
-
-		if int(n) != arrSize {
-			return fmt.Errorf("short write. %d vs %d", n, arrSize)
+		if !copied {
+			vals = append([]Valuer(nil), vals...)
+			copied = true
 		}
-
-		return nil
+		vals[i] = tv.valuer()
 	}
+	return vals
 }
 
-func Bool(yes bool) Valuer {
-	return func(w io.Writer) error {
-		var t byte = 0x00
-		if yes {
-			t = 0x01
-		}
-		_, err := w.Write([]byte{0x0e, t})
-		return err
-	}
+type nullValue struct{}
+
+// Null encodes null, which is a bool without a value
+func Null() Valuer { return nullValue{} }
+
+func (nullValue) EncodedSize() int { return 1 }
+
+func (nullValue) WriteTo(w io.Writer) (int64, error) {
+	return writeTag(w, TypeBool, 0)
+}
+
+type boolValue bool
+
+func Bool(yes bool) Valuer { return boolValue(yes) }
+
+func (boolValue) EncodedSize() int { return 2 }
+
+func (v boolValue) WriteTo(w io.Writer) (int64, error) {
+	var buf [2]byte
+	n, err := w.Write(AppendBool(buf[:0], bool(v)))
+	return int64(n), err
 }
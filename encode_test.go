@@ -3,6 +3,7 @@ package bipf
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -11,7 +12,7 @@ func TestMapOfWrongOrderSize(t *testing.T) {
 
 	v := MapOf(map[string]Valuer{}, "foo")
 
-	err := v(b)
+	_, err := v.WriteTo(b)
 	if err == nil {
 		t.Error("expected error")
 	}
@@ -22,8 +23,45 @@ func TestMapOfOrderdFieldNotInMap(t *testing.T) {
 
 	v := MapOf(map[string]Valuer{"foo": Bool(true)}, "nope")
 
-	err := v(b)
+	_, err := v.WriteTo(b)
 	if err == nil {
 		t.Error("expected error")
 	}
 }
+
+func TestEncodedSize(t *testing.T) {
+	long := strings.Repeat("x", 200)
+
+	for i, v := range []Valuer{
+		String(""),
+		String(long),
+		Bytes(nil),
+		Bytes([]byte(long)),
+		Int32(-1),
+		Double(0.5),
+		Bool(true),
+		Null(),
+		ListOf(),
+		ListOf(String(long), ListOf(Int32(1), Null())),
+		MapOf(map[string]Valuer{}),
+		MapOf(map[string]Valuer{
+			"a":  ListOf(String(long), Bytes([]byte(long))),
+			long: MapOf(map[string]Valuer{"b": Bool(false)}),
+		}, long, "a"),
+	} {
+		var b bytes.Buffer
+		n, err := v.WriteTo(&b)
+		if err != nil {
+			t.Fatalf("case %d: %s", i, err)
+		}
+		if int(n) != b.Len() {
+			t.Errorf("case %d: wrote %d bytes but reported %d", i, b.Len(), n)
+		}
+		if got := v.EncodedSize(); got != b.Len() {
+			t.Errorf("case %d: encoded size %d but wrote %d bytes", i, got, b.Len())
+		}
+		if err := Validate(b.Bytes()); err != nil {
+			t.Errorf("case %d: %s", i, err)
+		}
+	}
+}
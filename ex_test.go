@@ -1,6 +1,7 @@
 package bipf_test
 
 import (
+	"bytes"
 	"encoding/hex"
 	"math"
 	"os"
@@ -18,14 +19,14 @@ func ExampleMapOf() {
 	}, "i1", "s1", "d1", "b1", "b2")
 
 	hexd := hex.Dumper(os.Stdout)
-	if err := theMap(hexd); err != nil {
+	if _, err := theMap.WriteTo(hexd); err != nil {
 		panic(err)
 	}
 
 	// Output:
-	// 00000000  35 10 69 31 22 39 05 00  00 10 73 31 20 61 63 61  |5.i1"9....s1 aca|
-	// 00000010  62 10 64 31 43 ec 51 b8  1e 85 6b 37 40 10 62 31  |b.d1C.Q...k7@.b1|
-	// 00000020  0e 01 10 62 32 0e 00
+	// 00000000  b5 02 10 69 31 22 39 05  00 00 10 73 31 20 61 63  |...i1"9....s1 ac|
+	// 00000010  61 62 10 64 31 43 ec 51  b8 1e 85 6b 37 40 10 62  |ab.d1C.Q...k7@.b|
+	// 00000020  31 0e 01 10 62 32 0e 00
 }
 
 func ExampleListOf() {
@@ -40,12 +41,68 @@ func ExampleListOf() {
 	)
 
 	hexd := hex.Dumper(os.Stdout)
-	if err := theList(hexd); err != nil {
+	if _, err := theList.WriteTo(hexd); err != nil {
 		panic(err)
 	}
 
 	// Output:
-	// 00000000  4c 22 39 05 00 00 20 61  63 61 62 43 01 00 00 00  |L"9... acabC....|
-	// 00000010  00 00 f8 7f 43 ec 51 b8  1e 85 6b 37 40 0e 00 43  |....C.Q...k7@..C|
-	// 00000020  fc a9 f1 d2 4d 62 50 bf  0e 01
+	// 00000000  cc 02 22 39 05 00 00 20  61 63 61 62 43 01 00 00  |.."9... acabC...|
+	// 00000010  00 00 00 f8 7f 43 ec 51  b8 1e 85 6b 37 40 0e 00  |.....C.Q...k7@..|
+	// 00000020  43 fc a9 f1 d2 4d 62 50  bf 0e 01
+}
+
+func ExampleDump() {
+	theMap := bipf.MapOf(map[string]bipf.Valuer{
+		"type":     bipf.String("post"),
+		"mentions": bipf.ListOf(bipf.Int32(1), bipf.Null()),
+		"blob":     bipf.Bytes([]byte{0xde, 0xad, 0xbe, 0xef}),
+		"d":        bipf.Double(23.42),
+	}, "type", "mentions", "blob", "d")
+
+	var buf bytes.Buffer
+	if _, err := theMap.WriteTo(&buf); err != nil {
+		panic(err)
+	}
+
+	if err := bipf.Dump(os.Stdout, buf.Bytes()); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// 00000000  fd 02           Object len=47 tag=381
+	// 00000002  20                String len=4 tag=32 "type"
+	// 00000007  20                String len=4 tag=32 "post"
+	// 0000000c  40                String len=8 tag=64 "mentions"
+	// 00000015  34                Array len=6 tag=52
+	// 00000016  22                  Int32 len=4 tag=34 1
+	// 0000001b  06                  Bool len=0 tag=6 null
+	// 0000001c  20                String len=4 tag=32 "blob"
+	// 00000021  21                Buffer len=4 tag=33 deadbeef
+	// 00000026  08                String len=1 tag=8 "d"
+	// 00000028  43                Double len=8 tag=67 23.42
+}
+
+func ExampleDump_malformed() {
+	data := []byte{
+		0x5d,                  // object of 11 bytes
+		0x08, 'a', 0x12, 1, 0, // a: int32 with only 2 bytes
+		0x08, 'b', 0x0c, 0x0f, // b: array with a reserved type
+		0x08, 'c', // c: key without a value
+		0x28, 'h', 'i', // string of 5 bytes with only 2
+	}
+
+	if err := bipf.Dump(os.Stdout, data); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// 00000000  5d              Object len=11 tag=93
+	// 00000001  08                String len=1 tag=8 "a"
+	// 00000003  12                Int32 len=2 tag=18 !! expected 4 bytes of value
+	// 00000006  08                String len=1 tag=8 "b"
+	// 00000008  0c                Array len=1 tag=12
+	// 00000009                      !! malformed: invalid type Reserved in tag 15 (1 bytes: 0f)
+	// 0000000a  08                String len=1 tag=8 "c"
+	// 0000000c                    !! object has a key without a value
+	// 0000000c                  !! malformed: String of length 5 doesn't fit into the 2 remaining bytes (3 bytes: 286869)
 }
@@ -2,4 +2,4 @@ module github.com/ssb-ngi-pointer/go-bipf
 
 go 1.16
 
-require github.com/stretchr/testify v1.7.0 // indirect
+require github.com/stretchr/testify v1.7.0
@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: MIT
+
+package bipf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrStopIteration can be returned by the callbacks of IterateObject and IterateArray to stop early.
+// The iteration then returns nil.
+var ErrStopIteration = errors.New("bipf: stop iteration")
+
+// IterateObject calls fn for each entry of the current object, with the key and the type and offset of the value.
+// The values are not read, unless fn does so.
+//
+// When fn is called, the decoder is positioned at the value as if Type() was just called for it,
+// so fn can use the accessors or Skip and Next. The key is only valid until fn returns.
+// Afterwards the decoder is positioned after the object, also when fn returned ErrStopIteration.
+// If Type() wasn't called for the current value, its tag is read first.
+func (d *Decoder) IterateObject(fn func(key []byte, valueType Type, valueOffset int) error) error {
+	end, err := d.enterContainer(TypeObject)
+	if err != nil {
+		return err
+	}
+
+	var keyBuf []byte
+	for pos := d.valueStart; pos < end; {
+		if err := d.seekTo(pos); err != nil {
+			return err
+		}
+
+		keyType, err := d.Type()
+		if err != nil {
+			return err
+		}
+		if want := TypeString; keyType != want {
+			return ErrUnexpectedType{Want: want, Got: keyType}
+		}
+
+		if cap(keyBuf) < int(d.currentLen) {
+			keyBuf = make([]byte, d.currentLen)
+		}
+		keyBuf = keyBuf[:d.currentLen]
+		if _, err := io.ReadFull(d.input, keyBuf); err != nil {
+			return fmt.Errorf("bipf: failed to read key: %w", err)
+		}
+
+		valueOffset := d.valueStart + int64(d.currentLen)
+		if valueOffset >= end {
+			return ErrMalformed{Offset: int(valueOffset), Reason: "object key without a value"}
+		}
+		if err := d.seekTo(valueOffset); err != nil {
+			return err
+		}
+		valueType, err := d.Type()
+		if err != nil {
+			return err
+		}
+		pos = d.valueStart + int64(d.currentLen)
+
+		err = fn(keyBuf, valueType, int(valueOffset))
+		if err == ErrStopIteration {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.seekTo(end)
+}
+
+// IterateArray calls fn for each entry of the current array, with its index, type and offset.
+// The entries are not read, unless fn does so.
+//
+// When fn is called, the decoder is positioned at the entry as if Type() was just called for it,
+// so fn can use the accessors or Skip and Next.
+// Afterwards the decoder is positioned after the array, also when fn returned ErrStopIteration.
+// If Type() wasn't called for the current value, its tag is read first.
+func (d *Decoder) IterateArray(fn func(index int, t Type, offset int) error) error {
+	end, err := d.enterContainer(TypeArray)
+	if err != nil {
+		return err
+	}
+
+	for pos, idx := d.valueStart, 0; pos < end; idx++ {
+		if err := d.seekTo(pos); err != nil {
+			return err
+		}
+
+		t, err := d.Type()
+		if err != nil {
+			return err
+		}
+		next := d.valueStart + int64(d.currentLen)
+
+		err = fn(idx, t, int(pos))
+		if err == ErrStopIteration {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		pos = next
+	}
+
+	return d.seekTo(end)
+}
+
+// enterContainer checks that the current value is of type want and returns its end
+func (d *Decoder) enterContainer(want Type) (int64, error) {
+	if d.currentType == typeUninited {
+		if _, err := d.Type(); err != nil {
+			return -1, err
+		}
+	}
+
+	if d.currentType != want {
+		return -1, ErrUnexpectedType{Want: want, Got: d.currentType}
+	}
+
+	return d.valueStart + int64(d.currentLen), nil
+}
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: MIT
+
+package bipf_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+func TestIterateObject(t *testing.T) {
+	r := require.New(t)
+
+	data := testMessageData(t)
+	dec := bipf.NewDecoder(bytes.NewReader(data))
+	r.NoError(dec.SeekToLabel("value"))
+
+	var (
+		keys  []string
+		types []bipf.Type
+		seq   int32
+	)
+	err := dec.IterateObject(func(key []byte, valueType bipf.Type, valueOffset int) error {
+		keys = append(keys, string(key))
+		types = append(types, valueType)
+
+		// the offset points at the tag of the value
+		vt, err := bipf.View(data).Type(valueOffset)
+		r.NoError(err)
+		r.Equal(valueType, vt)
+
+		if string(key) == "sequence" {
+			seq, err = dec.Int32()
+			return err
+		}
+		return nil
+	})
+	r.NoError(err)
+	r.Equal([]string{"author", "sequence", "timestamp", "content"}, keys)
+	r.Equal([]bipf.Type{bipf.TypeString, bipf.TypeInt32, bipf.TypeDouble, bipf.TypeObject}, types)
+	r.EqualValues(23, seq)
+
+	// the decoder is after the object now, which was the last value
+	_, err = dec.Type()
+	r.Error(err)
+
+	// stop early
+	dec = bipf.NewDecoder(bytes.NewReader(data))
+	keys = nil
+	err = dec.IterateObject(func(key []byte, _ bipf.Type, _ int) error {
+		keys = append(keys, string(key))
+		return bipf.ErrStopIteration
+	})
+	r.NoError(err)
+	r.Equal([]string{"key"}, keys)
+
+	// other errors are returned
+	errTest := errors.New("test")
+	dec = bipf.NewDecoder(bytes.NewReader(data))
+	err = dec.IterateObject(func([]byte, bipf.Type, int) error { return errTest })
+	r.Equal(errTest, err)
+
+	// not an object
+	dec = bipf.NewDecoder(bytes.NewReader(encodeValuer(t, bipf.ListOf())))
+	err = dec.IterateObject(func([]byte, bipf.Type, int) error { return nil })
+	r.Equal(bipf.ErrUnexpectedType{Want: bipf.TypeObject, Got: bipf.TypeArray}, err)
+
+	// lengths that don't fit into the input are rejected before the key is allocated
+	for _, data := range [][]byte{
+		{0x85, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x08, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01},
+		{0x3d, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x02},
+	} {
+		dec = bipf.NewDecoderWithOptions(bytes.NewReader(data), bipf.DecoderOptions{MaxDepth: 10})
+		err = dec.IterateObject(func([]byte, bipf.Type, int) error { return nil })
+		var malformed bipf.ErrMalformed
+		r.True(errors.As(err, &malformed), "unexpected error: %v", err)
+	}
+
+	// [{"a"}, true], the key must not pick up the value after the object
+	dec = bipf.NewDecoder(bytes.NewReader([]byte{0x2c, 0x15, 0x08, 0x61, 0x0e, 0x01}))
+	_, err = dec.Type()
+	r.NoError(err)
+	r.NoError(dec.Next())
+	called := false
+	err = dec.IterateObject(func([]byte, bipf.Type, int) error {
+		called = true
+		return nil
+	})
+	var malformed bipf.ErrMalformed
+	r.True(errors.As(err, &malformed), "unexpected error: %v", err)
+	r.False(called)
+}
+
+func TestIterateArray(t *testing.T) {
+	r := require.New(t)
+
+	data := encodeValuer(t, bipf.ListOf(
+		bipf.Int32(1),
+		bipf.ListOf(bipf.String("nested")),
+		bipf.String("three"),
+		bipf.Bool(true),
+	))
+
+	dec := bipf.NewDecoder(bytes.NewReader(data))
+	var (
+		types   []bipf.Type
+		offsets []int
+		nested  int
+	)
+	err := dec.IterateArray(func(idx int, typ bipf.Type, offset int) error {
+		r.Equal(len(types), idx)
+		types = append(types, typ)
+		offsets = append(offsets, offset)
+
+		if typ == bipf.TypeArray {
+			return dec.IterateArray(func(int, bipf.Type, int) error {
+				nested++
+				return nil
+			})
+		}
+		if idx == 2 {
+			return bipf.ErrStopIteration
+		}
+		return nil
+	})
+	r.NoError(err)
+	r.Equal([]bipf.Type{bipf.TypeInt32, bipf.TypeArray, bipf.TypeString}, types)
+	r.Equal([]int{2, 7, 15}, offsets)
+	r.Equal(1, nested)
+}
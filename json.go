@@ -0,0 +1,392 @@
+// SPDX-License-Identifier: MIT
+
+package bipf
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// FromJSON reads a single JSON value from r and writes it encoded to w.
+//
+// Unlike going through map[string]interface{}, this keeps the order of object keys.
+// Like the JS implementation, integers that fit into 32 bits are encoded as Int32 and all other numbers as Double.
+// A repeated key in an object keeps its first position but gets the last value, as with JSON.parse.
+func FromJSON(r io.Reader, w io.Writer) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	val, err := valuerFromJSON(dec)
+	if err != nil {
+		return err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("bipf: expected a single JSON value")
+	}
+
+	_, err = val.WriteTo(w)
+	return err
+}
+
+func valuerFromJSON(dec *json.Decoder) (Valuer, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("bipf: failed to read JSON token: %w", err)
+	}
+
+	switch v := tok.(type) {
+	case nil:
+		return Null(), nil
+
+	case bool:
+		return Bool(v), nil
+
+	case string:
+		return String(v), nil
+
+	case json.Number:
+		return numberFromJSON(v)
+
+	case json.Delim:
+		switch v {
+		case '[':
+			var items []Valuer
+			for dec.More() {
+				item, err := valuerFromJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			if _, err := dec.Token(); err != nil { // ]
+				return nil, err
+			}
+			return ListOf(items...), nil
+
+		case '{':
+			var (
+				m     = make(map[string]Valuer)
+				order []string
+			)
+			for dec.More() {
+				tok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, ok := tok.(string)
+				if !ok {
+					return nil, fmt.Errorf("bipf: expected JSON object key, got %v", tok)
+				}
+
+				val, err := valuerFromJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+
+				if _, has := m[key]; !has {
+					order = append(order, key)
+				}
+				m[key] = val
+			}
+			if _, err := dec.Token(); err != nil { // }
+				return nil, err
+			}
+			return MapOf(m, order...), nil
+		}
+	}
+
+	return nil, fmt.Errorf("bipf: unexpected JSON token: %v", tok)
+}
+
+// numberFromJSON encodes integers that fit into 32 bits as Int32 and all other numbers as Double
+func numberFromJSON(n json.Number) (Valuer, error) {
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return nil, fmt.Errorf("bipf: invalid JSON number %q: %w", n, err)
+	}
+
+	if f == math.Trunc(f) && f >= math.MinInt32 && f <= math.MaxInt32 {
+		return Int32(int32(f)), nil
+	}
+	return Double(f), nil
+}
+
+// BufferFormat selects how ToJSON writes buffers, which have no JSON equivalent
+type BufferFormat uint
+
+const (
+	// BufferBase64 writes buffers as strings in standard base64 encoding
+	BufferBase64 BufferFormat = iota
+
+	// BufferHex writes buffers as strings of lowercase hex digits
+	BufferHex
+
+	// BufferSSB writes buffers as SSB blob references, "&" followed by base64 and ".sha256"
+	BufferSSB
+)
+
+// JSONOptions change the output of ToJSONWithOptions
+type JSONOptions struct {
+	// Indent is repeated once per level of nesting for pretty-printing.
+	// If it's empty, the output is compact.
+	Indent string
+
+	Buffers BufferFormat
+}
+
+// ToJSON writes the value in data as compact JSON to w, with buffers as base64 strings
+func ToJSON(w io.Writer, data []byte) error {
+	return ToJSONWithOptions(w, data, JSONOptions{})
+}
+
+// ToJSONWithOptions writes the value in data as JSON to w, walking the encoding directly.
+//
+// Object keys are written in the order they are encoded. Like JSON.stringify, NaN and infinite doubles become null.
+// An error is returned if data is malformed, nests deeper than MaxNesting or holds more than one value,
+// in which case parts of the JSON may already be written.
+func ToJSONWithOptions(w io.Writer, data []byte, opts JSONOptions) error {
+	jw := jsonWriter{w: w, view: View(data), opts: opts}
+
+	end, err := jw.value(0, 0)
+	if err != nil {
+		return err
+	}
+	if end != len(data) {
+		return ErrMalformed{Offset: end, Reason: fmt.Sprintf("%d bytes of trailing data", len(data)-end)}
+	}
+	return jw.flush()
+}
+
+// jsonFlushSize is the amount of output buffered before it's written
+const jsonFlushSize = 4096
+
+type jsonWriter struct {
+	w    io.Writer
+	view View
+	opts JSONOptions
+
+	// buf holds output that wasn't written to w yet
+	buf []byte
+}
+
+func (jw *jsonWriter) flush() error {
+	_, err := jw.w.Write(jw.buf)
+	jw.buf = jw.buf[:0]
+	return err
+}
+
+// newline starts a new line at the given depth when pretty-printing
+func (jw *jsonWriter) newline(depth int) {
+	if jw.opts.Indent == "" {
+		return
+	}
+	jw.buf = append(jw.buf, '\n')
+	for i := 0; i < depth; i++ {
+		jw.buf = append(jw.buf, jw.opts.Indent...)
+	}
+}
+
+// value writes the value at offset and returns the offset after it
+func (jw *jsonWriter) value(offset, depth int) (int, error) {
+	if len(jw.buf) >= jsonFlushSize {
+		if err := jw.flush(); err != nil {
+			return -1, err
+		}
+	}
+
+	v := jw.view
+	typ, length, start, err := v.Tag(offset)
+	if err != nil {
+		return -1, err
+	}
+	if err := checkNesting(typ, depth+1); err != nil {
+		return -1, err
+	}
+	end := start + length
+
+	switch typ {
+	case TypeString:
+		jw.buf = appendJSONString(jw.buf, v[start:end])
+
+	case TypeBuffer:
+		jw.buf = jw.appendBuffer(jw.buf, v[start:end])
+
+	case TypeInt32:
+		i, err := v.Int32(offset)
+		if err != nil {
+			return -1, err
+		}
+		jw.buf = strconv.AppendInt(jw.buf, int64(i), 10)
+
+	case TypeDouble:
+		f, err := v.Double(offset)
+		if err != nil {
+			return -1, err
+		}
+		jw.buf = appendJSONNumber(jw.buf, f)
+
+	case TypeBool:
+		if v.IsNull(offset) {
+			jw.buf = append(jw.buf, "null"...)
+			break
+		}
+		b, err := v.Bool(offset)
+		if err != nil {
+			return -1, err
+		}
+		jw.buf = strconv.AppendBool(jw.buf, b)
+
+	case TypeArray:
+		jw.buf = append(jw.buf, '[')
+		for pos := start; pos < end; {
+			if pos > start {
+				jw.buf = append(jw.buf, ',')
+			}
+			jw.newline(depth + 1)
+			pos, err = jw.value(pos, depth+1)
+			if err != nil {
+				return -1, err
+			}
+		}
+		if length > 0 {
+			jw.newline(depth)
+		}
+		jw.buf = append(jw.buf, ']')
+
+	case TypeObject:
+		jw.buf = append(jw.buf, '{')
+		for pos := start; pos < end; {
+			if pos > start {
+				jw.buf = append(jw.buf, ',')
+			}
+			jw.newline(depth + 1)
+
+			key, err := v.StringBytes(pos)
+			if err != nil {
+				return -1, ErrMalformed{Offset: pos, Reason: fmt.Sprintf("object key: %s", err)}
+			}
+			jw.buf = appendJSONString(jw.buf, key)
+			jw.buf = append(jw.buf, ':')
+			if jw.opts.Indent != "" {
+				jw.buf = append(jw.buf, ' ')
+			}
+
+			pos, err = v.Skip(pos)
+			if err != nil {
+				return -1, err
+			}
+			if pos >= end {
+				return -1, ErrMalformed{Offset: pos, Reason: "object key without a value"}
+			}
+			pos, err = jw.value(pos, depth+1)
+			if err != nil {
+				return -1, err
+			}
+		}
+		if length > 0 {
+			jw.newline(depth)
+		}
+		jw.buf = append(jw.buf, '}')
+
+	default:
+		return -1, ErrMalformed{Offset: offset, Reason: fmt.Sprintf("invalid type: %s", typ)}
+	}
+
+	return end, nil
+}
+
+func (jw *jsonWriter) appendBuffer(dst, b []byte) []byte {
+	dst = append(dst, '"')
+	switch jw.opts.Buffers {
+	case BufferHex:
+		n := len(dst)
+		dst = append(dst, make([]byte, hex.EncodedLen(len(b)))...)
+		hex.Encode(dst[n:], b)
+
+	case BufferSSB:
+		dst = append(dst, '&')
+		dst = appendBase64(dst, b)
+		dst = append(dst, ".sha256"...)
+
+	default:
+		dst = appendBase64(dst, b)
+	}
+	return append(dst, '"')
+}
+
+func appendBase64(dst, b []byte) []byte {
+	n := len(dst)
+	dst = append(dst, make([]byte, base64.StdEncoding.EncodedLen(len(b)))...)
+	base64.StdEncoding.Encode(dst[n:], b)
+	return dst
+}
+
+// appendJSONNumber formats f like encoding/json and JSON.stringify
+func appendJSONNumber(dst []byte, f float64) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return append(dst, "null"...)
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, 64)
+
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst
+}
+
+// appendJSONString quotes s like encoding/json, without escaping HTML characters
+func appendJSONString(dst, s []byte) []byte {
+	const hexDigits = "0123456789abcdef"
+
+	dst = append(dst, '"')
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				dst = append(dst, '\\', c)
+			case c == '\n':
+				dst = append(dst, '\\', 'n')
+			case c == '\r':
+				dst = append(dst, '\\', 'r')
+			case c == '\t':
+				dst = append(dst, '\\', 't')
+			case c < 0x20:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			default:
+				dst = append(dst, c)
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRune(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			dst = append(dst, "\ufffd"...)
+		case r == '\u2028' || r == '\u2029':
+			// valid JSON, but not valid JavaScript
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+		default:
+			dst = append(dst, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(dst, '"')
+}
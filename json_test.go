@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: MIT
+
+package bipf_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+func TestFromJSONFixtures(t *testing.T) {
+	for _, f := range loadFixtures(t) {
+		if strings.Contains(f.Name, "various types") {
+			// has a Buffer, which can't come from JSON
+			continue
+		}
+
+		f := f
+		t.Run(f.Name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, bipf.FromJSON(bytes.NewReader(f.JSON.raw), &buf))
+			require.Equal(t, f.Binary.Data(), buf.Bytes())
+		})
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	r := require.New(t)
+
+	var buf bytes.Buffer
+	input := `{"z":1,"a":[true,null,1.5,-2147483649,2147483647,1e3],"m":"<x>","z":2}`
+	r.NoError(bipf.FromJSON(strings.NewReader(input), &buf))
+
+	want := bipf.MapOf(map[string]bipf.Valuer{
+		"z": bipf.Int32(2),
+		"a": bipf.ListOf(
+			bipf.Bool(true),
+			bipf.Null(),
+			bipf.Double(1.5),
+			bipf.Double(-2147483649),
+			bipf.Int32(2147483647),
+			bipf.Int32(1000),
+		),
+		"m": bipf.String("<x>"),
+	}, "z", "a", "m")
+	r.Equal(encodeValuer(t, want), buf.Bytes())
+
+	for _, broken := range []string{``, `{} {}`, `{"a":`, `[1,]`, `{1:2}`} {
+		r.Error(bipf.FromJSON(strings.NewReader(broken), &buf), "input: %s", broken)
+	}
+}
+
+func TestToJSONFixtures(t *testing.T) {
+	for _, f := range loadFixtures(t) {
+		if strings.Contains(f.Name, "various types") {
+			// has a Buffer, which is written as a string
+			continue
+		}
+
+		f := f
+		t.Run(f.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			for _, opts := range []bipf.JSONOptions{{}, {Indent: "\t"}} {
+				var buf bytes.Buffer
+				r.NoError(bipf.ToJSONWithOptions(&buf, f.Binary.Data(), opts))
+
+				var got interface{}
+				r.NoError(json.Unmarshal(buf.Bytes(), &got), "invalid JSON: %s", buf.String())
+				r.Equal(f.JSON.val, got)
+			}
+		})
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	r := require.New(t)
+
+	data := encodeValuer(t, bipf.MapOf(map[string]bipf.Valuer{
+		"z":     bipf.Int32(-1),
+		"empty": bipf.ListOf(),
+		"list":  bipf.ListOf(bipf.Null(), bipf.Bool(false), bipf.Double(0.5), bipf.MapOf(map[string]bipf.Valuer{})),
+		"blob":  bipf.Bytes([]byte{0xde, 0xad, 0xbe, 0xef}),
+	}, "z", "empty", "list", "blob"))
+
+	var buf bytes.Buffer
+	r.NoError(bipf.ToJSON(&buf, data))
+	r.Equal(`{"z":-1,"empty":[],"list":[null,false,0.5,{}],"blob":"3q2+7w=="}`, buf.String())
+
+	buf.Reset()
+	r.NoError(bipf.ToJSONWithOptions(&buf, data, bipf.JSONOptions{Indent: "  ", Buffers: bipf.BufferHex}))
+	r.Equal(`{
+  "z": -1,
+  "empty": [],
+  "list": [
+    null,
+    false,
+    0.5,
+    {}
+  ],
+  "blob": "deadbeef"
+}`, buf.String())
+
+	buf.Reset()
+	r.NoError(bipf.ToJSONWithOptions(&buf, encodeValuer(t, bipf.Bytes([]byte{0xde, 0xad})), bipf.JSONOptions{Buffers: bipf.BufferSSB}))
+	r.Equal(`"&3q0=.sha256"`, buf.String())
+
+	r.Error(bipf.ToJSON(&buf, append(data, 0x06)), "trailing data")
+	r.Error(bipf.ToJSON(&buf, data[:len(data)-1]), "truncated")
+	r.Error(bipf.ToJSON(&buf, []byte{0x07}), "reserved type")
+}
+
+func TestToJSONLikeEncodingJSON(t *testing.T) {
+	r := require.New(t)
+
+	for _, s := range []string{
+		"", "plain", `"quoted" \ back`, "<html> & more", "tab\tnew\nline\r\x00\x1f\x7f",
+		"ünïcödé ✓ 🎉", "line \u2028 separator \u2029", "broken \xff utf8",
+	} {
+		var want bytes.Buffer
+		enc := json.NewEncoder(&want)
+		enc.SetEscapeHTML(false)
+		r.NoError(enc.Encode(s))
+
+		var got bytes.Buffer
+		r.NoError(bipf.ToJSON(&got, encodeValuer(t, bipf.String(s))))
+		r.Equal(strings.TrimSuffix(want.String(), "\n"), got.String())
+	}
+
+	for _, f := range []float64{0, -0.5, 1.5, 1e20, 1e21, 123456789.125, 1e-6, 1e-7, -2.5e-10, math.MaxFloat64, math.SmallestNonzeroFloat64} {
+		want, err := json.Marshal(f)
+		r.NoError(err)
+
+		var got bytes.Buffer
+		r.NoError(bipf.ToJSON(&got, encodeValuer(t, bipf.Double(f))))
+		r.Equal(string(want), got.String())
+	}
+
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		var got bytes.Buffer
+		r.NoError(bipf.ToJSON(&got, encodeValuer(t, bipf.Double(f))))
+		r.Equal("null", got.String())
+	}
+}
@@ -0,0 +1,280 @@
+// SPDX-License-Identifier: MIT
+
+package bipf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Marshal returns the bipf encoding of v.
+//
+// Structs are encoded as objects, with the fields in the order they are declared.
+// The key of a field is its name, unless the field has a `bipf:"name"` tag.
+// The omitempty option, as in `bipf:"name,omitempty"`, skips fields that hold the zero value of their type
+// and fields tagged with `bipf:"-"` are always skipped.
+//
+// Maps with string or integer keys are encoded as objects with their keys sorted.
+// Slices and arrays are encoded as arrays, except for []byte which is encoded as a buffer.
+// Integers that fit into 32 bits are encoded as Int32, larger ones and all floats as Double.
+// Nil pointers and interfaces are encoded as null, nil slices and maps as empty arrays and objects.
+//
+// Values implementing Marshaler are encoded with the Valuer their MarshalBIPF method returns
+// and Valuers, like the ones from MapOf and ListOf, are encoded as they are.
+func Marshal(v interface{}) ([]byte, error) {
+	val, err := valuerOf(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return encodeValuer(val)
+}
+
+func encodeValuer(val Valuer) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(val.EncodedSize())
+	if _, err := val.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Marshaler is implemented by types that encode themselves
+type Marshaler interface {
+	MarshalBIPF() (Valuer, error)
+}
+
+var (
+	marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	valuerType    = reflect.TypeOf((*Valuer)(nil)).Elem()
+	valueType     = reflect.TypeOf(Value{})
+)
+
+// ErrUnsupportedType is returned by Marshal if it can't encode a value of that type
+type ErrUnsupportedType struct {
+	Type reflect.Type
+}
+
+func (err ErrUnsupportedType) Error() string {
+	return fmt.Sprintf("bipf: unsupported type: %s", err.Type)
+}
+
+// valuerOf walks v and turns it into a Valuer
+func valuerOf(v reflect.Value) (Valuer, error) {
+	if !v.IsValid() {
+		return Null(), nil
+	}
+
+	if v.Type().Implements(marshalerType) {
+		if v.Kind() != reflect.Ptr || !v.IsNil() {
+			return marshalValuer(v.Interface().(Marshaler))
+		}
+	} else if v.Kind() != reflect.Ptr && v.CanAddr() && v.Addr().Type().Implements(marshalerType) {
+		return marshalValuer(v.Addr().Interface().(Marshaler))
+	}
+
+	// a Value that isn't addressable, like one passed directly, can't use its pointer methods
+	if v.Type() == valueType {
+		val := v.Interface().(Value)
+		return val.valuer(), nil
+	}
+
+	if v.Type().Implements(valuerType) && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+		return v.Interface().(Valuer), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return Bool(v.Bool()), nil
+
+	case reflect.String:
+		return String(v.String()), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if i < math.MinInt32 || i > math.MaxInt32 {
+			return Double(float64(i)), nil
+		}
+		return Int32(int32(i)), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		if u > math.MaxInt32 {
+			return Double(float64(u)), nil
+		}
+		return Int32(int32(u)), nil
+
+	case reflect.Float32, reflect.Float64:
+		return Double(v.Float()), nil
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return Null(), nil
+		}
+		return valuerOf(v.Elem())
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return Bytes(v.Bytes()), nil
+		}
+		return listValuerOf(v)
+
+	case reflect.Array:
+		return listValuerOf(v)
+
+	case reflect.Map:
+		return mapValuerOf(v)
+
+	case reflect.Struct:
+		return structValuerOf(v)
+	}
+
+	return nil, ErrUnsupportedType{Type: v.Type()}
+}
+
+func marshalValuer(m Marshaler) (Valuer, error) {
+	val, err := m.MarshalBIPF()
+	if err != nil {
+		return nil, fmt.Errorf("bipf: MarshalBIPF of %T failed: %w", m, err)
+	}
+	if val == nil {
+		return nil, fmt.Errorf("bipf: MarshalBIPF of %T returned no value", m)
+	}
+	return val, nil
+}
+
+func listValuerOf(v reflect.Value) (Valuer, error) {
+	items := make([]Valuer, v.Len())
+	for i := range items {
+		var err error
+		items[i], err = valuerOf(v.Index(i))
+		if err != nil {
+			return nil, fmt.Errorf("index %d: %w", i, err)
+		}
+	}
+	return ListOf(items...), nil
+}
+
+func mapValuerOf(v reflect.Value) (Valuer, error) {
+	var (
+		m    = make(map[string]Valuer, v.Len())
+		keys = make([]string, 0, v.Len())
+	)
+
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := mapKeyOf(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+
+		val, err := valuerOf(iter.Value())
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", key, err)
+		}
+
+		m[key] = val
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return MapOf(m, keys...), nil
+}
+
+func mapKeyOf(k reflect.Value) (string, error) {
+	switch k.Kind() {
+	case reflect.String:
+		return k.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", ErrUnsupportedType{Type: k.Type()}
+}
+
+func structValuerOf(v reflect.Value) (Valuer, error) {
+	var (
+		t     = v.Type()
+		m     = make(map[string]Valuer, t.NumField())
+		order = make([]string, 0, t.NumField())
+	)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+
+		name, omitEmpty, skip := parseFieldTag(field)
+		if skip {
+			continue
+		}
+
+		fv := v.Field(i)
+		if omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+
+		if _, has := m[name]; has {
+			return nil, fmt.Errorf("bipf: duplicate field name %q in %s", name, t)
+		}
+
+		val, err := valuerOf(fv)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+
+		m[name] = val
+		order = append(order, name)
+	}
+
+	return MapOf(m, order...), nil
+}
+
+// parseFieldTag returns the key name of a struct field and its options
+func parseFieldTag(field reflect.StructField) (name string, omitEmpty, skip bool) {
+	tag := field.Tag.Get("bipf")
+	if tag == "-" {
+		return "", false, true
+	}
+
+	name = field.Name
+	if tag == "" {
+		return name, false, false
+	}
+
+	parts := strings.Split(tag, ",")
+	if parts[0] != "" {
+		name = parts[0]
+	}
+
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty, false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: MIT
+
+package bipf_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+type testRepo struct {
+	Type string `bipf:"type"`
+	URL  string `bipf:"url,omitempty"`
+}
+
+type testPackage struct {
+	Name     string            `bipf:"name"`
+	Version  int               `bipf:"version"`
+	Private  bool              `bipf:"private,omitempty"`
+	Score    float64           `bipf:"score"`
+	Repo     *testRepo         `bipf:"repository"`
+	Keywords []string          `bipf:"keywords"`
+	Deps     map[string]string `bipf:"dependencies"`
+	Big      int64
+	Ignored  string `bipf:"-"`
+
+	notExported bool
+}
+
+func TestMarshalStruct(t *testing.T) {
+	r := require.New(t)
+
+	pkg := testPackage{
+		Name:     "bipf",
+		Version:  3,
+		Score:    0.5,
+		Repo:     &testRepo{Type: "git"},
+		Keywords: []string{"binary", "in-place"},
+		Deps:     map[string]string{"varint": "^5.0.0", "faker": "^5.5.1"},
+		Big:      1 << 40,
+		Ignored:  "nope",
+	}
+
+	got, err := bipf.Marshal(pkg)
+	r.NoError(err)
+
+	want := bipf.MapOf(map[string]bipf.Valuer{
+		"name":    bipf.String("bipf"),
+		"version": bipf.Int32(3),
+		"score":   bipf.Double(0.5),
+		"repository": bipf.MapOf(map[string]bipf.Valuer{
+			"type": bipf.String("git"),
+		}),
+		"keywords": bipf.ListOf(bipf.String("binary"), bipf.String("in-place")),
+		"dependencies": bipf.MapOf(map[string]bipf.Valuer{
+			"faker":  bipf.String("^5.5.1"),
+			"varint": bipf.String("^5.0.0"),
+		}, "faker", "varint"),
+		"Big": bipf.Double(1 << 40),
+	}, "name", "version", "score", "repository", "keywords", "dependencies", "Big")
+
+	var wantBuf bytes.Buffer
+	_, err = want.WriteTo(&wantBuf)
+	r.NoError(err)
+	r.Equal(wantBuf.Bytes(), got)
+
+	// pointers are followed
+	gotPtr, err := bipf.Marshal(&pkg)
+	r.NoError(err)
+	r.Equal(got, gotPtr)
+}
+
+func TestMarshalScalars(t *testing.T) {
+	r := require.New(t)
+
+	for i, tc := range []struct {
+		In   interface{}
+		Want bipf.Valuer
+	}{
+		{int8(-1), bipf.Int32(-1)},
+		{uint32(1 << 31), bipf.Double(1 << 31)},
+		{float32(0.25), bipf.Double(0.25)},
+		{"hello", bipf.String("hello")},
+		{true, bipf.Bool(true)},
+		{[]int{}, bipf.ListOf()},
+		{[]byte{0xde, 0xad}, bipf.Bytes([]byte{0xde, 0xad})},
+		{[2]bool{true, false}, bipf.ListOf(bipf.Bool(true), bipf.Bool(false))},
+		{map[int]bool{1: true}, bipf.MapOf(map[string]bipf.Valuer{"1": bipf.Bool(true)})},
+		{map[string]int(nil), bipf.MapOf(nil)},
+		{[]interface{}{1, "a"}, bipf.ListOf(bipf.Int32(1), bipf.String("a"))},
+		{
+			map[string]interface{}{
+				"l": bipf.ListOf(bipf.Int32(1)),
+				"x": bipf.MapOf(map[string]bipf.Valuer{"y": bipf.Null()}),
+			},
+			bipf.MapOf(map[string]bipf.Valuer{
+				"l": bipf.ListOf(bipf.Int32(1)),
+				"x": bipf.MapOf(map[string]bipf.Valuer{"y": bipf.Null()}),
+			}, "l", "x"),
+		},
+		{bipf.String("valuer"), bipf.String("valuer")},
+	} {
+		got, err := bipf.Marshal(tc.In)
+		r.NoError(err, "case %d", i)
+
+		var want bytes.Buffer
+		_, err = tc.Want.WriteTo(&want)
+		r.NoError(err)
+		r.Equal(want.Bytes(), got, "case %d", i)
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	r := require.New(t)
+
+	_, err := bipf.Marshal(make(chan int))
+	var unsupported bipf.ErrUnsupportedType
+	r.True(errors.As(err, &unsupported), "unexpected error: %v", err)
+
+	_, err = bipf.Marshal(map[string]interface{}{"fn": func() {}})
+	r.True(errors.As(err, &unsupported), "unexpected error: %v", err)
+
+	_, err = bipf.Marshal(map[bool]int{true: 1})
+	r.True(errors.As(err, &unsupported), "unexpected error: %v", err)
+
+	_, err = bipf.Marshal(struct {
+		A string `bipf:"x"`
+		B string `bipf:"x"`
+	}{})
+	r.Error(err)
+}
+
+// testFeedRef encodes itself as a sigil string, like @<base64>.ed25519
+type testFeedRef struct {
+	ID []byte
+}
+
+func (ref testFeedRef) MarshalBIPF() (bipf.Valuer, error) {
+	if len(ref.ID) != 32 {
+		return nil, fmt.Errorf("feedRef: invalid length: %d", len(ref.ID))
+	}
+	return bipf.String("@" + base64.StdEncoding.EncodeToString(ref.ID) + ".ed25519"), nil
+}
+
+func (ref *testFeedRef) UnmarshalBIPF(data []byte) error {
+	str, err := bipf.View(data).StringBytes(0)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.HasPrefix(str, []byte("@")) || !bytes.HasSuffix(str, []byte(".ed25519")) {
+		return fmt.Errorf("feedRef: invalid sigil: %q", str)
+	}
+
+	ref.ID, err = base64.StdEncoding.DecodeString(string(str[1 : len(str)-8]))
+	return err
+}
+
+type testMessage struct {
+	Author   testFeedRef    `bipf:"author"`
+	Mentions []*testFeedRef `bipf:"mentions"`
+	Sequence int            `bipf:"sequence"`
+}
+
+func TestMarshalerInterfaces(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		alice = testFeedRef{ID: bytes.Repeat([]byte{1}, 32)}
+		bob   = testFeedRef{ID: bytes.Repeat([]byte{2}, 32)}
+	)
+
+	msg := testMessage{
+		Author:   alice,
+		Mentions: []*testFeedRef{&bob},
+		Sequence: 23,
+	}
+
+	got, err := bipf.Marshal(msg)
+	r.NoError(err)
+
+	want := bipf.MapOf(map[string]bipf.Valuer{
+		"author":   bipf.String("@AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=.ed25519"),
+		"mentions": bipf.ListOf(bipf.String("@AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=.ed25519")),
+		"sequence": bipf.Int32(23),
+	}, "author", "mentions", "sequence")
+
+	var wantBuf bytes.Buffer
+	_, err = want.WriteTo(&wantBuf)
+	r.NoError(err)
+	r.Equal(wantBuf.Bytes(), got)
+
+	var decoded testMessage
+	r.NoError(bipf.Unmarshal(got, &decoded))
+	r.Equal(msg, decoded)
+
+	// errors from the custom types are passed on
+	_, err = bipf.Marshal(testMessage{})
+	r.Error(err)
+
+	var wrongSigil testFeedRef
+	wrongData, err := bipf.Marshal("%nope.sha256")
+	r.NoError(err)
+	r.Error(bipf.Unmarshal(wrongData, &wrongSigil))
+}
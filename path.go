@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: MIT
+
+package bipf
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathSegment is either an object key or an array index (if index is not -1)
+type pathSegment struct {
+	key   string
+	index int
+}
+
+// parsePath splits p at the dots into object keys.
+// A key can be followed by array indexes in brackets, like "mentions[3]" or "branch[0][1]".
+// Brackets that don't hold a number are kept as part of the key.
+func parsePath(p string) []pathSegment {
+	var segs []pathSegment
+	for _, part := range strings.Split(p, ".") {
+		var indexes []int
+		for strings.HasSuffix(part, "]") {
+			open := strings.LastIndexByte(part, '[')
+			if open < 0 {
+				break
+			}
+			idx, err := strconv.Atoi(part[open+1 : len(part)-1])
+			if err != nil || idx < 0 {
+				break
+			}
+			indexes = append(indexes, idx)
+			part = part[:open]
+		}
+
+		if part != "" || len(indexes) == 0 {
+			segs = append(segs, pathSegment{key: part, index: -1})
+		}
+		// the indexes were collected from the end
+		for i := len(indexes) - 1; i >= 0; i-- {
+			segs = append(segs, pathSegment{index: indexes[i]})
+		}
+	}
+	return segs
+}
+
+// formatPath is the inverse of parsePath
+func formatPath(segs []pathSegment) string {
+	var sb strings.Builder
+	for i, seg := range segs {
+		if seg.index >= 0 {
+			fmt.Fprintf(&sb, "[%d]", seg.index)
+			continue
+		}
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(seg.key)
+	}
+	return sb.String()
+}
+
+// Path is a chain of object keys and array indexes that was prepared for repeated lookups, see CompilePath.
+type Path struct {
+	segments []pathSegment
+
+	// encoded holds each key encoded as a bipf string, including its tag. It is nil for indexes.
+	encoded [][]byte
+}
+
+// CompilePath splits p into object keys and array indexes, like SeekToLabel does, and encodes each key up front.
+// Seeking with the returned Path then only compares bytes instead of decoding keys.
+func CompilePath(p string) *Path {
+	return compilePath(parsePath(p))
+}
+
+// CompilePathOf is like CompilePath but takes the object keys as a slice.
+func CompilePathOf(keys ...string) *Path {
+	segs := make([]pathSegment, len(keys))
+	for i, key := range keys {
+		segs[i] = pathSegment{key: key, index: -1}
+	}
+	return compilePath(segs)
+}
+
+func compilePath(segs []pathSegment) *Path {
+	path := &Path{
+		segments: segs,
+		encoded:  make([][]byte, len(segs)),
+	}
+
+	for i, seg := range segs {
+		if seg.index >= 0 {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if _, err := String(seg.key).WriteTo(&buf); err != nil {
+			panic(err) // a bytes.Buffer doesn't fail
+		}
+		path.encoded[i] = buf.Bytes()
+	}
+
+	return path
+}
+
+// String returns the keys of the path joined by dots, with indexes in brackets
+func (p *Path) String() string {
+	return formatPath(p.segments)
+}
+
+// Seek seeks through the stream of the decoder until it finds the value of the path, just like SeekToLabel.
+// Each key is read together with its tag and compared to the encoded key in one go,
+// like SeekView this expects tags in the shortest form.
+func (p *Path) Seek(d *Decoder) error {
+	for i, seg := range p.segments {
+		var err error
+		if seg.index >= 0 {
+			err = d.SeekToIndex(seg.index)
+		} else {
+			err = d.seekEncodedKey(seg.key, p.encoded[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SeekView returns the offset of the value of the path, starting at the value at offset.
+// The keys are compared including their tags, which the JS implementation always encodes in the shortest form.
+func (p *Path) SeekView(v View, offset int) (int, error) {
+	for i, seg := range p.segments {
+		var err error
+		if seg.index >= 0 {
+			offset, err = v.SeekIndex(offset, seg.index)
+			if err != nil {
+				return -1, err
+			}
+			continue
+		}
+
+		offset, err = seekEncodedKey(v, offset, p.encoded[i])
+		if err != nil {
+			if err == ErrNotFound {
+				return -1, fmt.Errorf("%w: %q", ErrNotFound, seg.key)
+			}
+			return -1, err
+		}
+	}
+	return offset, nil
+}
+
+// seekEncodedKey returns the offset of the value for the encoded key in the object at offset
+func seekEncodedKey(v View, offset int, encodedKey []byte) (int, error) {
+	typ, length, start, err := v.Tag(offset)
+	if err != nil {
+		return -1, err
+	}
+	if want := TypeObject; typ != want {
+		return -1, ErrUnexpectedType{Want: want, Got: typ}
+	}
+	end := start + length
+
+	for pos := start; pos < end; {
+		keyEnd, err := v.Skip(pos)
+		if err != nil {
+			return -1, err
+		}
+		if keyEnd >= end {
+			return -1, ErrMalformed{Offset: pos, Reason: "object key without a value"}
+		}
+
+		if bytes.HasPrefix(v[pos:end], encodedKey) {
+			return pos + len(encodedKey), nil
+		}
+
+		// skip the value
+		pos, err = v.Skip(keyEnd)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	return -1, ErrNotFound
+}
@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: MIT
+
+package bipf_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+func testMessageData(t testing.TB) []byte {
+	msg := bipf.MapOf(map[string]bipf.Valuer{
+		"key": bipf.String("%Xv2D9dHPChXWqL6FeNYqW4asO6XGCz8ahVXvwwu9LvY=.sha256"),
+		"value": bipf.MapOf(map[string]bipf.Valuer{
+			"author":    bipf.String("@AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=.ed25519"),
+			"sequence":  bipf.Int32(23),
+			"timestamp": bipf.Double(1618833216123),
+			"content": bipf.MapOf(map[string]bipf.Valuer{
+				"type": bipf.String("post"),
+				"text": bipf.String("hello, world"),
+			}, "type", "text"),
+		}, "author", "sequence", "timestamp", "content"),
+	}, "key", "value")
+
+	var buf bytes.Buffer
+	if _, err := msg.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompiledPath(t *testing.T) {
+	r := require.New(t)
+
+	data := testMessageData(t)
+	v := bipf.View(data)
+
+	p := bipf.CompilePath("value.content.type")
+	r.Equal("value.content.type", p.String())
+
+	off, err := p.SeekView(v, 0)
+	r.NoError(err)
+	typ, err := v.StringBytes(off)
+	r.NoError(err)
+	r.Equal("post", string(typ))
+
+	dec := bipf.NewDecoder(bytes.NewReader(data))
+	r.NoError(p.Seek(dec))
+	dt, err := dec.Type()
+	r.NoError(err)
+	r.Equal(bipf.TypeString, dt)
+	str, err := dec.CopyString()
+	r.NoError(err)
+	r.Equal("post", str)
+
+	dec = bipf.NewDecoder(bytes.NewReader(data))
+	r.NoError(bipf.CompilePath("value.content.text").Seek(dec))
+	_, err = dec.Type()
+	r.NoError(err)
+	str, err = dec.CopyString()
+	r.NoError(err)
+	r.Equal("hello, world", str)
+
+	// keys with dots
+	p = bipf.CompilePathOf("value", "content.type")
+	_, err = p.SeekView(v, 0)
+	r.True(errors.Is(err, bipf.ErrNotFound), "unexpected error: %v", err)
+	r.Contains(err.Error(), "content.type")
+
+	err = p.Seek(bipf.NewDecoder(bytes.NewReader(data)))
+	r.True(errors.Is(err, bipf.ErrNotFound), "unexpected error: %v", err)
+
+	// a key longer than the rest of the object
+	err = bipf.CompilePath("value.content.a-key-that-is-longer-than-the-rest").Seek(bipf.NewDecoder(bytes.NewReader(data)))
+	r.True(errors.Is(err, bipf.ErrNotFound), "unexpected error: %v", err)
+
+	// {"a"} followed by true, the key must not pick up the value after the object
+	keyOnly := []byte{0x15, 0x08, 0x61, 0x0e, 0x01}
+	_, err = bipf.CompilePath("a").SeekView(keyOnly, 0)
+	var malformed bipf.ErrMalformed
+	r.True(errors.As(err, &malformed), "unexpected error: %v", err)
+	err = bipf.CompilePath("a").Seek(bipf.NewDecoder(bytes.NewReader(keyOnly)))
+	r.True(errors.As(err, &malformed), "unexpected error: %v", err)
+	err = bipf.NewDecoder(bytes.NewReader(keyOnly)).SeekToLabel("a")
+	r.True(errors.As(err, &malformed), "unexpected error: %v", err)
+
+	_, err = bipf.CompilePath("value.sequence.nope").SeekView(v, 0)
+	r.Equal(bipf.ErrUnexpectedType{Want: bipf.TypeObject, Got: bipf.TypeInt32}, err)
+
+	p = bipf.CompilePath("value.content.type")
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := p.SeekView(v, 0); err != nil {
+			panic(err)
+		}
+	})
+	r.Zero(allocs)
+}
+
+func BenchmarkCompiledPath(b *testing.B) {
+	v := bipf.View(testMessageData(b))
+	p := bipf.CompilePath("value.content.type")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.SeekView(v, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkViewSeekPath(b *testing.B) {
+	v := bipf.View(testMessageData(b))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := v.SeekPath(0, "value", "content", "type"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestPathIndexes(t *testing.T) {
+	r := require.New(t)
+
+	data := encodeValuer(t, bipf.MapOf(map[string]bipf.Valuer{
+		"mentions": bipf.ListOf(
+			bipf.String("@alice"),
+			bipf.MapOf(map[string]bipf.Valuer{"link": bipf.String("@bob")}),
+		),
+		"branch": bipf.ListOf(bipf.ListOf(bipf.Int32(1), bipf.Int32(2))),
+		"a[b]":   bipf.Bool(true),
+	}, "mentions", "branch", "a[b]"))
+	v := bipf.View(data)
+
+	for _, tc := range []struct {
+		Path string
+		Want bipf.Valuer
+	}{
+		{"mentions[0]", bipf.String("@alice")},
+		{"mentions[1].link", bipf.String("@bob")},
+		{"branch[0][1]", bipf.Int32(2)},
+		{"a[b]", bipf.Bool(true)},
+	} {
+		want := encodeValuer(t, tc.Want)
+
+		p := bipf.CompilePath(tc.Path)
+		r.Equal(tc.Path, p.String())
+
+		off, err := p.SeekView(v, 0)
+		r.NoError(err, "path %s", tc.Path)
+		raw, err := v.Raw(off)
+		r.NoError(err)
+		r.Equal(want, raw, "path %s", tc.Path)
+
+		dec := bipf.NewDecoder(bytes.NewReader(data))
+		r.NoError(dec.SeekToLabel(tc.Path), "path %s", tc.Path)
+		r.NoError(dec.Skip())
+	}
+
+	// out of range
+	_, err := bipf.CompilePath("mentions[2]").SeekView(v, 0)
+	r.True(errors.Is(err, bipf.ErrNotFound), "unexpected error: %v", err)
+
+	dec := bipf.NewDecoder(bytes.NewReader(data))
+	err = dec.SeekToLabel("branch[0][2]")
+	r.True(errors.Is(err, bipf.ErrNotFound), "unexpected error: %v", err)
+
+	// not an array
+	_, err = bipf.CompilePath("mentions[0][0]").SeekView(v, 0)
+	r.Equal(bipf.ErrUnexpectedType{Want: bipf.TypeArray, Got: bipf.TypeString}, err)
+
+	// SeekToIndex on its own
+	dec = bipf.NewDecoder(bytes.NewReader(data))
+	r.NoError(dec.SeekToLabel("branch[0]"))
+	r.NoError(dec.SeekToIndex(1))
+	dt, err := dec.Type()
+	r.NoError(err)
+	r.Equal(bipf.TypeInt32, dt)
+	i, err := dec.Int32()
+	r.NoError(err)
+	r.EqualValues(2, i)
+}
@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: MIT
+
+package bipf
+
+import (
+	"errors"
+	"io"
+)
+
+// StreamEncoder writes values one call at a time, for arrays and objects
+// whose entries aren't known up front.
+//
+// The tag of a container depends on the size of its entries, so everything inside open containers
+// is buffered and written to the underlying writer when the outermost container ends.
+// Values outside of containers are written as soon as they are encoded.
+type StreamEncoder struct {
+	w   io.Writer
+	buf sliceWriter
+
+	open []openContainer
+
+	// err is the first error returned by w
+	err error
+}
+
+type openContainer struct {
+	offset int
+	typ    Type
+
+	// wantValue is set in objects after a key was written
+	wantValue bool
+}
+
+// NewStreamEncoder returns a StreamEncoder writing to w
+func NewStreamEncoder(w io.Writer) *StreamEncoder {
+	return &StreamEncoder{w: w}
+}
+
+var (
+	errStreamNoContainer = errors.New("bipf: no open array or object")
+	errStreamWantKey     = errors.New("bipf: expected a key for the object")
+	errStreamWantValue   = errors.New("bipf: expected a value for the last key")
+	errStreamNotObject   = errors.New("bipf: keys are only allowed in objects")
+)
+
+// StartArray starts an array, its items are the following values until End is called
+func (e *StreamEncoder) StartArray() error {
+	return e.start(TypeArray)
+}
+
+// StartObject starts an object. Each value in it has to be preceded by a call to Key, until End is called.
+func (e *StreamEncoder) StartObject() error {
+	return e.start(TypeObject)
+}
+
+func (e *StreamEncoder) start(t Type) error {
+	if err := e.beforeValue(); err != nil {
+		return err
+	}
+
+	var offset int
+	e.buf.b, offset = beginContainer(e.buf.b)
+	e.open = append(e.open, openContainer{offset: offset, typ: t})
+	return nil
+}
+
+// Key writes the key for the next value of the current object
+func (e *StreamEncoder) Key(k string) error {
+	if e.err != nil {
+		return e.err
+	}
+	if len(e.open) == 0 {
+		return errStreamNoContainer
+	}
+
+	top := &e.open[len(e.open)-1]
+	switch {
+	case top.typ != TypeObject:
+		return errStreamNotObject
+	case top.wantValue:
+		return errStreamWantValue
+	}
+
+	e.buf.b = AppendString(e.buf.b, k)
+	top.wantValue = true
+	return nil
+}
+
+// Value writes v as the next value.
+// A v that fails to encode is dropped and another value can be written instead.
+func (e *StreamEncoder) Value(v Valuer) error {
+	if err := e.beforeValue(); err != nil {
+		return err
+	}
+
+	n := len(e.buf.b)
+	if _, err := v.WriteTo(&e.buf); err != nil {
+		e.buf.b = e.buf.b[:n]
+		if len(e.open) > 0 {
+			top := &e.open[len(e.open)-1]
+			top.wantValue = top.typ == TypeObject
+		}
+		return err
+	}
+
+	if len(e.open) > 0 {
+		return nil
+	}
+
+	_, e.err = e.w.Write(e.buf.b)
+	e.buf.b = e.buf.b[:0]
+	return e.err
+}
+
+// End finishes the innermost open array or object
+func (e *StreamEncoder) End() error {
+	if e.err != nil {
+		return e.err
+	}
+	if len(e.open) == 0 {
+		return errStreamNoContainer
+	}
+
+	top := e.open[len(e.open)-1]
+	if top.wantValue {
+		return errStreamWantValue
+	}
+	e.open = e.open[:len(e.open)-1]
+	e.buf.b = endContainer(e.buf.b, top.offset, top.typ)
+
+	if len(e.open) > 0 {
+		return nil
+	}
+
+	_, e.err = e.w.Write(e.buf.b)
+	e.buf.b = e.buf.b[:0]
+	return e.err
+}
+
+// beforeValue checks that a value can be written now
+func (e *StreamEncoder) beforeValue() error {
+	if e.err != nil {
+		return e.err
+	}
+	if len(e.open) == 0 {
+		return nil
+	}
+
+	top := &e.open[len(e.open)-1]
+	if top.typ == TypeObject {
+		if !top.wantValue {
+			return errStreamWantKey
+		}
+		top.wantValue = false
+	}
+	return nil
+}
+
+// sliceWriter appends everything written to it to b
+type sliceWriter struct {
+	b []byte
+}
+
+func (sw *sliceWriter) Write(p []byte) (int, error) {
+	sw.b = append(sw.b, p...)
+	return len(p), nil
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: MIT
+
+package bipf_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+func TestStreamEncoder(t *testing.T) {
+	r := require.New(t)
+
+	long := strings.Repeat("x", 200)
+
+	var buf bytes.Buffer
+	enc := bipf.NewStreamEncoder(&buf)
+
+	r.NoError(enc.Value(bipf.Int32(1)))
+	r.Equal(5, buf.Len(), "values outside of containers are written directly")
+
+	r.NoError(enc.StartArray())
+	for i := 0; i < 3; i++ {
+		r.NoError(enc.StartObject())
+		r.NoError(enc.Key("seq"))
+		r.NoError(enc.Value(bipf.Int32(int32(i))))
+		r.NoError(enc.Key("text"))
+		r.NoError(enc.Value(bipf.String(long)))
+		r.NoError(enc.Key("mentions"))
+		r.NoError(enc.StartArray())
+		r.NoError(enc.End())
+		r.NoError(enc.End())
+	}
+	r.Equal(5, buf.Len(), "open containers are buffered")
+	r.NoError(enc.End())
+
+	item := func(i int32) bipf.Valuer {
+		return bipf.MapOf(map[string]bipf.Valuer{
+			"seq":      bipf.Int32(i),
+			"text":     bipf.String(long),
+			"mentions": bipf.ListOf(),
+		}, "seq", "text", "mentions")
+	}
+	var want []byte
+	want = append(want, encodeValuer(t, bipf.Int32(1))...)
+	want = append(want, encodeValuer(t, bipf.ListOf(item(0), item(1), item(2)))...)
+	r.Equal(want, buf.Bytes())
+}
+
+func TestStreamEncoderErrors(t *testing.T) {
+	r := require.New(t)
+
+	var buf bytes.Buffer
+	enc := bipf.NewStreamEncoder(&buf)
+
+	r.Error(enc.End(), "nothing to end")
+	r.Error(enc.Key("top"), "key outside of an object")
+
+	r.NoError(enc.StartArray())
+	r.Error(enc.Key("nope"), "key in an array")
+
+	r.NoError(enc.StartObject())
+	r.Error(enc.Value(bipf.Null()), "value without a key")
+	r.NoError(enc.Key("a"))
+	r.Error(enc.Key("b"), "two keys in a row")
+	r.Error(enc.End(), "key without a value")
+	r.NoError(enc.Value(bipf.Null()))
+	r.NoError(enc.End())
+	r.NoError(enc.End())
+
+	r.NoError(bipf.Validate(buf.Bytes()))
+
+	// a value that fails halfway isn't kept
+	buf.Reset()
+	enc = bipf.NewStreamEncoder(&buf)
+	r.NoError(enc.StartObject())
+	r.NoError(enc.Key("a"))
+	r.Error(enc.Value(bipf.ListOf(bipf.Int32(1), bipf.MapOf(map[string]bipf.Valuer{}, "x"))))
+	r.NoError(enc.Value(bipf.Int32(1)))
+	r.NoError(enc.End())
+	r.Equal(encodeValuer(t, bipf.MapOf(map[string]bipf.Valuer{"a": bipf.Int32(1)})), buf.Bytes())
+
+	// also at the top, where errors of the value don't break the encoder
+	buf.Reset()
+	enc = bipf.NewStreamEncoder(&buf)
+	r.Error(enc.Value(bipf.MapOf(map[string]bipf.Valuer{}, "x")))
+	r.NoError(enc.Value(bipf.Int32(1)))
+	r.Equal(encodeValuer(t, bipf.Int32(1)), buf.Bytes())
+
+	// errors from the writer stick
+	enc = bipf.NewStreamEncoder(failingWriter{})
+	r.NoError(enc.StartArray())
+	r.Error(enc.End())
+	r.Error(enc.Value(bipf.Null()))
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
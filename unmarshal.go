@@ -0,0 +1,461 @@
+// SPDX-License-Identifier: MIT
+
+package bipf
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Unmarshal decodes the bipf encoded data and stores the result in the value pointed to by v.
+//
+// It uses the inverse of the rules Marshal uses. Object entries are matched to struct fields by
+// the name in their `bipf:"name"` tag or their field name, preferring an exact match over a case-insensitive one.
+// Keys without a matching field are ignored. Pointers are allocated as necessary.
+// Null sets pointers, interfaces, maps and slices to nil and leaves other values unchanged.
+//
+// Values implementing Unmarshaler get the complete encoding of their value, including the tag.
+// Arrays and objects nested deeper than MaxNesting are rejected.
+//
+// Decoded into an interface{}, the types map to string, []byte, int32, float64, bool, nil,
+// []interface{} and map[string]interface{}.
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("bipf: Unmarshal needs a non-nil pointer, not %T", v)
+	}
+
+	u := unmarshaler{view: View(data)}
+	end, err := u.decode(0, rv.Elem())
+	if err != nil {
+		return err
+	}
+
+	if end != len(data) {
+		return fmt.Errorf("bipf: %d bytes of trailing data after value", len(data)-end)
+	}
+	return nil
+}
+
+// Unmarshaler is implemented by types that decode themselves.
+// The data passed to UnmarshalBIPF is a single encoded value, including its tag.
+// It points into the data passed to Unmarshal and must be copied if it is kept after returning.
+type Unmarshaler interface {
+	UnmarshalBIPF(data []byte) error
+}
+
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+// ErrUnmarshalType is returned by Unmarshal if a value can't be stored in the Go value at that position
+type ErrUnmarshalType struct {
+	// Path is the location of the value in the document, like "repository.url" or "keywords[1]"
+	Path string
+
+	Got  Type
+	Want reflect.Type
+}
+
+func (err ErrUnmarshalType) Error() string {
+	if err.Path == "" {
+		return fmt.Sprintf("bipf: can't unmarshal %s into value of type %s", err.Got, err.Want)
+	}
+	return fmt.Sprintf("bipf: can't unmarshal %s into value of type %s at %s", err.Got, err.Want, err.Path)
+}
+
+// unmarshaler keeps the state of a single Unmarshal call
+type unmarshaler struct {
+	view View
+
+	// path holds the keys and indexes to the current value, for error messages
+	path []pathSegment
+}
+
+func (u *unmarshaler) push(key string, index int) {
+	u.path = append(u.path, pathSegment{key: key, index: index})
+}
+
+func (u *unmarshaler) pop() {
+	u.path = u.path[:len(u.path)-1]
+}
+
+func (u *unmarshaler) typeError(got Type, want reflect.Type) error {
+	return ErrUnmarshalType{Path: formatPath(u.path), Got: got, Want: want}
+}
+
+// decode stores the value at offset in v and returns the offset after it
+func (u *unmarshaler) decode(offset int, v reflect.Value) (int, error) {
+	typ, length, start, err := u.view.Tag(offset)
+	if err != nil {
+		return -1, err
+	}
+	if err := checkNesting(typ, len(u.path)+1); err != nil {
+		return -1, err
+	}
+	end := start + length
+
+	if v.Kind() != reflect.Ptr && v.CanAddr() && v.Addr().Type().Implements(unmarshalerType) {
+		if err := v.Addr().Interface().(Unmarshaler).UnmarshalBIPF(u.view[offset:end]); err != nil {
+			return -1, fmt.Errorf("bipf: UnmarshalBIPF of %s failed: %w", v.Addr().Type(), err)
+		}
+		return end, nil
+	}
+
+	if typ == TypeBool && length == 0 { // null
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return end, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return u.decode(offset, v.Elem())
+
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return -1, u.typeError(typ, v.Type())
+		}
+		generic, err := u.generic(offset)
+		if err != nil {
+			return -1, err
+		}
+		v.Set(reflect.ValueOf(generic))
+		return end, nil
+	}
+
+	switch typ {
+	case TypeBool:
+		if v.Kind() != reflect.Bool {
+			return -1, u.typeError(typ, v.Type())
+		}
+		b, err := u.view.Bool(offset)
+		if err != nil {
+			return -1, err
+		}
+		v.SetBool(b)
+
+	case TypeString:
+		if v.Kind() != reflect.String {
+			return -1, u.typeError(typ, v.Type())
+		}
+		v.SetString(string(u.view[start:end]))
+
+	case TypeBuffer:
+		if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Uint8 {
+			return -1, u.typeError(typ, v.Type())
+		}
+		buf := make([]byte, length)
+		copy(buf, u.view[start:end])
+		v.SetBytes(buf)
+
+	case TypeInt32:
+		i, err := u.view.Int32(offset)
+		if err != nil {
+			return -1, err
+		}
+		if err := u.setNumber(v, typ, float64(i)); err != nil {
+			return -1, err
+		}
+
+	case TypeDouble:
+		f, err := u.view.Double(offset)
+		if err != nil {
+			return -1, err
+		}
+		if err := u.setNumber(v, typ, f); err != nil {
+			return -1, err
+		}
+
+	case TypeArray:
+		if err := u.decodeArray(start, end, v); err != nil {
+			return -1, err
+		}
+
+	case TypeObject:
+		var err error
+		switch v.Kind() {
+		case reflect.Map:
+			err = u.decodeMap(start, end, v)
+		case reflect.Struct:
+			err = u.decodeStruct(start, end, v)
+		default:
+			err = u.typeError(typ, v.Type())
+		}
+		if err != nil {
+			return -1, err
+		}
+
+	default:
+		return -1, u.typeError(typ, v.Type())
+	}
+
+	return end, nil
+}
+
+// setNumber stores the number f in v if it fits into its kind without loss
+func (u *unmarshaler) setNumber(v reflect.Value, typ Type, f float64) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := int64(f)
+		if float64(i) != f || v.OverflowInt(i) {
+			return u.typeError(typ, v.Type())
+		}
+		v.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if f < 0 {
+			return u.typeError(typ, v.Type())
+		}
+		i := uint64(f)
+		if float64(i) != f || v.OverflowUint(i) {
+			return u.typeError(typ, v.Type())
+		}
+		v.SetUint(i)
+
+	case reflect.Float32, reflect.Float64:
+		if v.OverflowFloat(f) && !math.IsInf(f, 0) {
+			return u.typeError(typ, v.Type())
+		}
+		v.SetFloat(f)
+
+	default:
+		return u.typeError(typ, v.Type())
+	}
+	return nil
+}
+
+func (u *unmarshaler) decodeArray(start, end int, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		// count the entries first, so that the slice is only allocated once
+		var n int
+		for pos := start; pos < end; n++ {
+			var err error
+			pos, err = u.view.Skip(pos)
+			if err != nil {
+				return err
+			}
+		}
+		if v.IsNil() || v.Cap() < n {
+			v.Set(reflect.MakeSlice(v.Type(), n, n))
+		} else {
+			v.SetLen(n)
+		}
+
+	case reflect.Array:
+
+	default:
+		return u.typeError(TypeArray, v.Type())
+	}
+
+	var (
+		pos = start
+		idx int
+	)
+	for ; pos < end; idx++ {
+		var err error
+		if idx >= v.Len() {
+			// more entries than the Go array can hold
+			pos, err = u.view.Skip(pos)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		u.push("", idx)
+		pos, err = u.decode(pos, v.Index(idx))
+		if err != nil {
+			return err
+		}
+		u.pop()
+	}
+
+	// zero the rest of a Go array
+	for ; idx < v.Len(); idx++ {
+		v.Index(idx).Set(reflect.Zero(v.Type().Elem()))
+	}
+	return nil
+}
+
+func (u *unmarshaler) decodeMap(start, end int, v reflect.Value) error {
+	t := v.Type()
+	switch t.Key().Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		return u.typeError(TypeObject, t)
+	}
+
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(t))
+	}
+
+	return u.eachEntry(start, end, func(key string, valueOffset int) (int, error) {
+		kv := reflect.New(t.Key()).Elem()
+		switch kv.Kind() {
+		case reflect.String:
+			kv.SetString(key)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i, err := strconv.ParseInt(key, 10, 64)
+			if err != nil || kv.OverflowInt(i) {
+				return -1, u.typeError(TypeString, t.Key())
+			}
+			kv.SetInt(i)
+		default:
+			i, err := strconv.ParseUint(key, 10, 64)
+			if err != nil || kv.OverflowUint(i) {
+				return -1, u.typeError(TypeString, t.Key())
+			}
+			kv.SetUint(i)
+		}
+
+		ev := reflect.New(t.Elem()).Elem()
+		next, err := u.decode(valueOffset, ev)
+		if err != nil {
+			return -1, err
+		}
+		v.SetMapIndex(kv, ev)
+		return next, nil
+	})
+}
+
+func (u *unmarshaler) decodeStruct(start, end int, v reflect.Value) error {
+	t := v.Type()
+	return u.eachEntry(start, end, func(key string, valueOffset int) (int, error) {
+		idx := fieldIndex(t, key)
+		if idx < 0 {
+			return u.view.Skip(valueOffset)
+		}
+		return u.decode(valueOffset, v.Field(idx))
+	})
+}
+
+// fieldIndex returns the index of the struct field that should hold the value for key or -1
+func fieldIndex(t reflect.Type, key string) int {
+	var fold = -1
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+
+		name, _, skip := parseFieldTag(field)
+		if skip {
+			continue
+		}
+
+		if name == key {
+			return i
+		}
+		if fold < 0 && strings.EqualFold(name, key) {
+			fold = i
+		}
+	}
+	return fold
+}
+
+// eachEntry calls fn for each key of the object body between start and end.
+// fn decodes the value and returns the offset after it.
+func (u *unmarshaler) eachEntry(start, end int, fn func(key string, valueOffset int) (int, error)) error {
+	for pos := start; pos < end; {
+		key, err := u.view.StringBytes(pos)
+		if err != nil {
+			return err
+		}
+
+		valueOffset, err := u.view.Skip(pos)
+		if err != nil {
+			return err
+		}
+		if valueOffset >= end {
+			return ErrMalformed{Offset: valueOffset, Reason: "object key without a value"}
+		}
+
+		keyStr := string(key)
+		u.push(keyStr, -1)
+		pos, err = fn(keyStr, valueOffset)
+		if err != nil {
+			return err
+		}
+		u.pop()
+	}
+	return nil
+}
+
+// generic decodes the value at offset into the types used for interface{}
+func (u *unmarshaler) generic(offset int) (interface{}, error) {
+	typ, length, start, err := u.view.Tag(offset)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNesting(typ, len(u.path)+1); err != nil {
+		return nil, err
+	}
+	end := start + length
+
+	switch typ {
+	case TypeString:
+		return string(u.view[start:end]), nil
+
+	case TypeBuffer:
+		buf := make([]byte, length)
+		copy(buf, u.view[start:end])
+		return buf, nil
+
+	case TypeInt32:
+		return u.view.Int32(offset)
+
+	case TypeDouble:
+		return u.view.Double(offset)
+
+	case TypeBool:
+		if length == 0 {
+			return nil, nil
+		}
+		return u.view.Bool(offset)
+
+	case TypeArray:
+		var lst = []interface{}{}
+		for pos := start; pos < end; {
+			u.push("", len(lst))
+			val, err := u.generic(pos)
+			if err != nil {
+				return nil, err
+			}
+			u.pop()
+			lst = append(lst, val)
+
+			pos, err = u.view.Skip(pos)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return lst, nil
+
+	case TypeObject:
+		var m = map[string]interface{}{}
+		err := u.eachEntry(start, end, func(key string, valueOffset int) (int, error) {
+			val, err := u.generic(valueOffset)
+			if err != nil {
+				return -1, err
+			}
+			m[key] = val
+			return u.view.Skip(valueOffset)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("bipf: invalid type: %s", typ)
+}
@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: MIT
+
+package bipf_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+func TestUnmarshalRoundtrip(t *testing.T) {
+	r := require.New(t)
+
+	pkg := testPackage{
+		Name:     "bipf",
+		Version:  3,
+		Private:  true,
+		Score:    0.5,
+		Repo:     &testRepo{Type: "git", URL: "git://github.com/ssbc/bipf.git"},
+		Keywords: []string{"binary", "in-place"},
+		Deps:     map[string]string{"varint": "^5.0.0"},
+		Big:      1 << 40,
+		Ignored:  "nope",
+	}
+
+	data, err := bipf.Marshal(pkg)
+	r.NoError(err)
+
+	var got testPackage
+	r.NoError(bipf.Unmarshal(data, &got))
+
+	pkg.Ignored = ""
+	r.Equal(pkg, got)
+
+	var generic interface{}
+	r.NoError(bipf.Unmarshal(data, &generic))
+	r.Equal(map[string]interface{}{
+		"name":         "bipf",
+		"version":      int32(3),
+		"private":      true,
+		"score":        0.5,
+		"repository":   map[string]interface{}{"type": "git", "url": "git://github.com/ssbc/bipf.git"},
+		"keywords":     []interface{}{"binary", "in-place"},
+		"dependencies": map[string]interface{}{"varint": "^5.0.0"},
+		"Big":          float64(1 << 40),
+	}, generic)
+}
+
+func TestUnmarshalFixture(t *testing.T) {
+	r := require.New(t)
+
+	// {"1": true}
+	data, err := hex.DecodeString("2508310e01")
+	r.NoError(err)
+
+	var m map[int]bool
+	r.NoError(bipf.Unmarshal(data, &m))
+	r.Equal(map[int]bool{1: true}, m)
+
+	// [1, 2, 3, 4, 5, 6, 7, 8, 9]
+	data, err = hex.DecodeString("ec02220100000022020000002203000000220400000022050000002206000000220700000022080000002209000000")
+	r.NoError(err)
+
+	var lst []uint8
+	r.NoError(bipf.Unmarshal(data, &lst))
+	r.Equal([]uint8{1, 2, 3, 4, 5, 6, 7, 8, 9}, lst)
+
+	var arr [3]*int
+	r.NoError(bipf.Unmarshal(data, &arr))
+	r.Equal(3, *arr[2])
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	r := require.New(t)
+
+	data, err := bipf.Marshal(map[string]interface{}{
+		"a": []interface{}{1, 2, "three"},
+	})
+	r.NoError(err)
+
+	var wrong struct {
+		A []int
+	}
+	err = bipf.Unmarshal(data, &wrong)
+	var typeErr bipf.ErrUnmarshalType
+	r.True(errors.As(err, &typeErr), "unexpected error: %v", err)
+	r.Equal("a[2]", typeErr.Path)
+	r.Equal(bipf.TypeString, typeErr.Got)
+	r.Equal(reflect.TypeOf(0), typeErr.Want)
+
+	var small struct {
+		A []int8
+	}
+	data, err = bipf.Marshal(map[string]interface{}{"a": []int{1000}})
+	r.NoError(err)
+	err = bipf.Unmarshal(data, &small)
+	r.True(errors.As(err, &typeErr), "unexpected error: %v", err)
+	r.Equal("a[0]", typeErr.Path)
+
+	var s string
+	r.Error(bipf.Unmarshal(data, s), "not a pointer")
+	r.Error(bipf.Unmarshal(data[:len(data)-1], &s), "truncated")
+	r.Error(bipf.Unmarshal(append(data, 0), &wrong), "trailing data")
+
+	// [{"a"}, true], the key must not pick up the value after the object
+	var v interface{}
+	err = bipf.Unmarshal([]byte{0x2c, 0x15, 0x08, 0x61, 0x0e, 0x01}, &v)
+	var malformed bipf.ErrMalformed
+	r.True(errors.As(err, &malformed), "unexpected error: %v", err)
+}
+
+func TestMarshalNull(t *testing.T) {
+	r := require.New(t)
+
+	data, err := bipf.Marshal(nil)
+	r.NoError(err)
+	r.Equal([]byte{0x06}, data)
+	r.True(bipf.View(data).IsNull(0))
+
+	type withPointer struct {
+		Repo *testRepo `bipf:"repo"`
+		Any  interface{}
+	}
+
+	data, err = bipf.Marshal(withPointer{})
+	r.NoError(err)
+	r.Equal("5d207265706f0618416e7906", hex.EncodeToString(data))
+
+	got := withPointer{
+		Repo: &testRepo{Type: "git"},
+		Any:  "something",
+	}
+	r.NoError(bipf.Unmarshal(data, &got))
+	r.Nil(got.Repo)
+	r.Nil(got.Any)
+
+	var generic interface{} = 1
+	r.NoError(bipf.Unmarshal(data, &generic))
+	r.Equal(map[string]interface{}{"repo": nil, "Any": nil}, generic)
+
+	_, err = bipf.View(data).Bool(6)
+	r.Equal(bipf.ErrNull, err)
+}
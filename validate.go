@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: MIT
+
+package bipf
+
+import (
+	"fmt"
+
+	"github.com/ssb-ngi-pointer/go-bipf/internal/varint"
+)
+
+// ErrMalformed is returned by Validate for the first problem it finds in the data
+type ErrMalformed struct {
+	Offset int
+	Reason string
+}
+
+func (err ErrMalformed) Error() string {
+	return fmt.Sprintf("bipf: malformed data at offset %d: %s", err.Offset, err.Reason)
+}
+
+// Validate checks that data holds exactly one well-formed value.
+//
+// It checks that every value fits into the value surrounding it, that objects consist of pairs
+// of string keys and values and that bools, integers and doubles have the right lengths.
+// Arrays and objects can be nested at most MaxNesting levels deep.
+// Use it before handing data from untrusted sources to the other functions of this package.
+func Validate(data []byte) error {
+	if len(data) == 0 {
+		return ErrMalformed{Offset: 0, Reason: "no data"}
+	}
+
+	end, err := validateValue(data, 0, len(data), 1)
+	if err != nil {
+		return err
+	}
+
+	if end != len(data) {
+		return ErrMalformed{Offset: end, Reason: fmt.Sprintf("%d bytes of trailing data", len(data)-end)}
+	}
+	return nil
+}
+
+// MaxNesting is how deep arrays and objects can be nested in the data passed to the functions
+// that recurse into them: Validate and the ones using it (DecodeValue, IsCanonical and AppendCanonical),
+// Unmarshal, ToJSON, ToJSONWithOptions, Dump, Compare and CompareAt.
+// Deeper values are rejected with an ErrLimitExceeded for LimitDepth, Dump flags them instead.
+const MaxNesting = 10000
+
+// checkNesting returns an error if a value of type typ at depth is an array or object nested too deep
+func checkNesting(typ Type, depth int) error {
+	if (typ == TypeArray || typ == TypeObject) && depth > MaxNesting {
+		return ErrLimitExceeded{Limit: LimitDepth, Max: MaxNesting, Got: uint64(depth)}
+	}
+	return nil
+}
+
+// validateTag checks the tag at offset and that the value fits before end
+func validateTag(data []byte, offset, end int) (typ Type, valueStart, valueEnd int, err error) {
+	tag, n := varint.ConsumeVarint(data[offset:end])
+	if n < 0 {
+		return typeUninited, 0, 0, ErrMalformed{Offset: offset, Reason: "broken varint tag field"}
+	}
+
+	typ = Type(tag & tagMask)
+	if typ >= TypeReserved {
+		return typeUninited, 0, 0, ErrMalformed{Offset: offset, Reason: fmt.Sprintf("invalid type: %s", typ)}
+	}
+
+	valueStart = offset + n
+	length := tag >> tagSize
+	if length > uint64(end-valueStart) {
+		reason := fmt.Sprintf("%s of length %d doesn't fit into the %d remaining bytes", typ, length, end-valueStart)
+		return typeUninited, 0, 0, ErrMalformed{Offset: offset, Reason: reason}
+	}
+
+	return typ, valueStart, valueStart + int(length), nil
+}
+
+// validateValue checks the value at offset, which has to end before end, and returns the offset after it.
+// depth is the nesting of the value, starting at 1 at the top.
+func validateValue(data []byte, offset, end, depth int) (int, error) {
+	typ, start, valueEnd, err := validateTag(data, offset, end)
+	if err != nil {
+		return -1, err
+	}
+	if err := checkNesting(typ, depth); err != nil {
+		return -1, err
+	}
+	length := valueEnd - start
+
+	switch typ {
+	case TypeInt32:
+		if length != 4 {
+			return -1, ErrMalformed{Offset: offset, Reason: fmt.Sprintf("expected 4 bytes of int32, not %d", length)}
+		}
+
+	case TypeDouble:
+		if length != 8 {
+			return -1, ErrMalformed{Offset: offset, Reason: fmt.Sprintf("expected 8 bytes of double, not %d", length)}
+		}
+
+	case TypeBool:
+		if length > 1 {
+			return -1, ErrMalformed{Offset: offset, Reason: fmt.Sprintf("expected 0 or 1 bytes of bool, not %d", length)}
+		}
+		if length == 1 && data[start] > 1 {
+			return -1, ErrMalformed{Offset: start, Reason: fmt.Sprintf("invalid bool value: %d", data[start])}
+		}
+
+	case TypeArray:
+		for pos := start; pos < valueEnd; {
+			pos, err = validateValue(data, pos, valueEnd, depth+1)
+			if err != nil {
+				return -1, err
+			}
+		}
+
+	case TypeObject:
+		for pos := start; pos < valueEnd; {
+			keyType, _, keyEnd, err := validateTag(data, pos, valueEnd)
+			if err != nil {
+				return -1, err
+			}
+			if keyType != TypeString {
+				return -1, ErrMalformed{Offset: pos, Reason: fmt.Sprintf("object key is not a string but %s", keyType)}
+			}
+
+			if keyEnd == valueEnd {
+				return -1, ErrMalformed{Offset: keyEnd, Reason: "object key without a value"}
+			}
+
+			pos, err = validateValue(data, keyEnd, valueEnd, depth+1)
+			if err != nil {
+				return -1, err
+			}
+		}
+	}
+
+	return valueEnd, nil
+}
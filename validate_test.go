@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: MIT
+
+package bipf_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+func TestValidateFixtures(t *testing.T) {
+	r := require.New(t)
+
+	for _, ts := range loadFixtures(t) {
+		r.NoError(bipf.Validate(ts.Binary.Data()), "fixture %s", ts.Name)
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	for _, tc := range []struct {
+		Name   string
+		Hex    string
+		Offset int
+	}{
+		{"empty", "", 0},
+		{"broken varint", "ff", 0},
+		{"reserved type", "07", 0},
+		{"longer than data", "2868656c6c", 0},
+		{"trailing data", "0e0100", 2},
+		{"short int32", "1a0000", 0},
+		{"long double", "4b000000000000000000", 0},
+		{"long bool", "160000", 0},
+		{"invalid bool", "0e02", 1},
+		{"child longer than array", "1c2201000000", 1},
+		{"child longer than object", "2d0866220100", 3},
+		{"integer key", "3522010000000e01", 1},
+		{"key without value", "150866", 3},
+		{"nested problem", "1c140e05", 3},
+	} {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			data, err := hex.DecodeString(tc.Hex)
+			r.NoError(err)
+
+			err = bipf.Validate(data)
+			var malformed bipf.ErrMalformed
+			r.True(errors.As(err, &malformed), "unexpected error: %v", err)
+			r.Equal(tc.Offset, malformed.Offset, "wrong offset: %v", err)
+		})
+	}
+}
+
+func TestNestingLimit(t *testing.T) {
+	r := require.New(t)
+
+	nested := func(depth int) []byte {
+		var (
+			data    []byte
+			offsets = make([]int, depth)
+		)
+		for i := range offsets {
+			data, offsets[i] = bipf.BeginArray(data)
+		}
+		for i := depth - 1; i >= 0; i-- {
+			data = bipf.EndArray(data, offsets[i])
+		}
+		return data
+	}
+
+	ok := nested(bipf.MaxNesting)
+	r.NoError(bipf.Validate(ok))
+	var v interface{}
+	r.NoError(bipf.Unmarshal(ok, &v))
+	r.NoError(bipf.ToJSON(ioutil.Discard, ok))
+
+	tooDeep := nested(bipf.MaxNesting + 1)
+	want := bipf.ErrLimitExceeded{Limit: bipf.LimitDepth, Max: bipf.MaxNesting, Got: bipf.MaxNesting + 1}
+	r.Equal(want, bipf.Validate(tooDeep))
+	_, err := bipf.DecodeValue(tooDeep)
+	r.Equal(want, err)
+	r.Equal(want, bipf.Unmarshal(tooDeep, &v))
+	r.Equal(want, bipf.ToJSON(ioutil.Discard, tooDeep))
+
+	_, err = bipf.Compare(tooDeep, tooDeep)
+	r.Equal(want, err)
+	cmp, err := bipf.Compare(ok, ok)
+	r.NoError(err)
+	r.Zero(cmp)
+
+	// the listing is huge, the innermost array is flagged at its end
+	var last lastWrite
+	r.NoError(bipf.Dump(&last, tooDeep))
+	r.Contains(string(last), "!! malformed: Array nested deeper than 10000")
+}
+
+// lastWrite keeps only the data of the last write to it
+type lastWrite []byte
+
+func (lw *lastWrite) Write(p []byte) (int, error) {
+	*lw = append((*lw)[:0], p...)
+	return len(p), nil
+}
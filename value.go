@@ -0,0 +1,327 @@
+// SPDX-License-Identifier: MIT
+
+package bipf
+
+import (
+	"fmt"
+	"io"
+)
+
+//go:generate stringer -type=Kind -trimprefix Kind
+
+// Kind is the kind of a Value.
+// It has the same numbers as Type, except that null has its own kind instead of being a Bool.
+type Kind byte
+
+// This block defines the kinds of values
+const (
+	KindString Kind = iota
+	KindBuffer
+	KindInt32
+	KindDouble
+	KindArray
+	KindObject
+	KindBool
+	KindNull
+)
+
+// Value is a decoded value held in memory, that can be changed and encoded again.
+// Objects keep the order of their members. The zero Value is a String.
+//
+// Value implements Valuer, Marshaler and Unmarshaler.
+type Value struct {
+	kind Kind
+
+	str     string
+	buf     []byte
+	i       int32
+	f       float64
+	b       bool
+	items   []*Value
+	members []Member
+}
+
+// Member is a key and value of an object
+type Member struct {
+	Key   string
+	Value *Value
+}
+
+// NewString returns a String Value
+func NewString(s string) *Value { return &Value{kind: KindString, str: s} }
+
+// NewBuffer returns a Buffer Value, holding b without copying it
+func NewBuffer(b []byte) *Value { return &Value{kind: KindBuffer, buf: b} }
+
+// NewInt32 returns an Int32 Value
+func NewInt32(i int32) *Value { return &Value{kind: KindInt32, i: i} }
+
+// NewDouble returns a Double Value
+func NewDouble(f float64) *Value { return &Value{kind: KindDouble, f: f} }
+
+// NewBool returns a Bool Value
+func NewBool(b bool) *Value { return &Value{kind: KindBool, b: b} }
+
+// NewNull returns a null Value
+func NewNull() *Value { return &Value{kind: KindNull} }
+
+// NewArray returns an Array Value with the passed items
+func NewArray(items ...*Value) *Value { return &Value{kind: KindArray, items: items} }
+
+// NewObject returns an Object Value with the passed members, in that order
+func NewObject(members ...Member) *Value { return &Value{kind: KindObject, members: members} }
+
+// Kind returns the kind of v
+func (v *Value) Kind() Kind { return v.kind }
+
+// IsNull reports whether v is null
+func (v *Value) IsNull() bool { return v.kind == KindNull }
+
+// Type returns the type v is encoded with, which is TypeBool for null
+func (v *Value) Type() Type {
+	if v.kind == KindNull {
+		return TypeBool
+	}
+	return Type(v.kind)
+}
+
+func (v *Value) expect(k Kind) error {
+	switch {
+	case v.kind == k:
+		return nil
+	case v.kind == KindNull && k == KindBool:
+		return ErrNull
+	}
+	return ErrUnexpectedType{Got: v.Type(), Want: Type(k)}
+}
+
+// Str returns the string of a String Value
+func (v *Value) Str() (string, error) {
+	return v.str, v.expect(KindString)
+}
+
+// Bytes returns the bytes of a Buffer Value, without copying them
+func (v *Value) Bytes() ([]byte, error) {
+	return v.buf, v.expect(KindBuffer)
+}
+
+// Int32 returns the integer of an Int32 Value
+func (v *Value) Int32() (int32, error) {
+	return v.i, v.expect(KindInt32)
+}
+
+// Double returns the float of a Double Value
+func (v *Value) Double() (float64, error) {
+	return v.f, v.expect(KindDouble)
+}
+
+// Bool returns the bool of a Bool Value and ErrNull if v is null
+func (v *Value) Bool() (bool, error) {
+	return v.b, v.expect(KindBool)
+}
+
+// Len returns the number of items of an array or members of an object and 0 for all other kinds
+func (v *Value) Len() int {
+	switch v.kind {
+	case KindArray:
+		return len(v.items)
+	case KindObject:
+		return len(v.members)
+	}
+	return 0
+}
+
+// Items returns the items of an array. Changing the returned Values changes the array.
+func (v *Value) Items() []*Value {
+	return v.items
+}
+
+// Index returns the item i of an array and nil if v isn't an array or i is out of range
+func (v *Value) Index(i int) *Value {
+	if v.kind != KindArray || i < 0 || i >= len(v.items) {
+		return nil
+	}
+	return v.items[i]
+}
+
+// Append adds the items to the end of an array
+func (v *Value) Append(items ...*Value) error {
+	if err := v.expect(KindArray); err != nil {
+		return err
+	}
+	v.items = append(v.items, items...)
+	return nil
+}
+
+// Members returns the members of an object in order. Changing the returned Values changes the object.
+func (v *Value) Members() []Member {
+	return v.members
+}
+
+// Get returns the value of the first member of an object with the key
+// and nil if v isn't an object or has no such member
+func (v *Value) Get(key string) *Value {
+	if v.kind != KindObject {
+		return nil
+	}
+	for _, m := range v.members {
+		if m.Key == key {
+			return m.Value
+		}
+	}
+	return nil
+}
+
+// Set changes the value of the member with the key, keeping its position in the object.
+// If there is no such member yet, it's added to the end of the object.
+func (v *Value) Set(key string, val *Value) error {
+	if err := v.expect(KindObject); err != nil {
+		return err
+	}
+	for i, m := range v.members {
+		if m.Key == key {
+			v.members[i].Value = val
+			return nil
+		}
+	}
+	v.members = append(v.members, Member{Key: key, Value: val})
+	return nil
+}
+
+// Delete removes all members with the key from an object and reports whether there were any
+func (v *Value) Delete(key string) bool {
+	if v.kind != KindObject {
+		return false
+	}
+	kept := v.members[:0]
+	for _, m := range v.members {
+		if m.Key != key {
+			kept = append(kept, m)
+		}
+	}
+	deleted := len(kept) != len(v.members)
+	for i := len(kept); i < len(v.members); i++ {
+		v.members[i] = Member{}
+	}
+	v.members = kept
+	return deleted
+}
+
+// DecodeValue decodes the single value in data.
+// Strings and buffers are copied, so data can be reused afterwards.
+// Like Validate, it rejects arrays and objects nested deeper than MaxNesting.
+func DecodeValue(data []byte) (*Value, error) {
+	if err := Validate(data); err != nil {
+		return nil, err
+	}
+	return decodeValue(View(data), 0), nil
+}
+
+// decodeValue decodes the value at off, which is already validated
+func decodeValue(view View, off int) *Value {
+	typ, length, start, _ := view.Tag(off)
+	end := start + length
+
+	switch typ {
+	case TypeString:
+		return NewString(string(view[start:end]))
+
+	case TypeBuffer:
+		return NewBuffer(append([]byte{}, view[start:end]...))
+
+	case TypeInt32:
+		i, _ := view.Int32(off)
+		return NewInt32(i)
+
+	case TypeDouble:
+		f, _ := view.Double(off)
+		return NewDouble(f)
+
+	case TypeBool:
+		if length == 0 {
+			return NewNull()
+		}
+		return NewBool(view[start] == 1)
+
+	case TypeArray:
+		v := NewArray()
+		for pos := start; pos < end; pos, _ = view.Skip(pos) {
+			v.items = append(v.items, decodeValue(view, pos))
+		}
+		return v
+
+	default: // objects
+		v := NewObject()
+		for pos := start; pos < end; {
+			key, _ := view.StringBytes(pos)
+			pos, _ = view.Skip(pos)
+			v.members = append(v.members, Member{Key: string(key), Value: decodeValue(view, pos)})
+			pos, _ = view.Skip(pos)
+		}
+		return v
+	}
+}
+
+// valuer returns a Valuer for the current content of v, nil Values are encoded as null
+func (v *Value) valuer() Valuer {
+	if v == nil {
+		return Null()
+	}
+
+	switch v.kind {
+	case KindString:
+		return String(v.str)
+	case KindBuffer:
+		return Bytes(v.buf)
+	case KindInt32:
+		return Int32(v.i)
+	case KindDouble:
+		return Double(v.f)
+	case KindBool:
+		return Bool(v.b)
+	case KindNull:
+		return Null()
+
+	case KindArray:
+		items := make([]Valuer, len(v.items))
+		for i, item := range v.items {
+			items[i] = item.valuer()
+		}
+		return ListOf(items...)
+
+	case KindObject:
+		keys := make([]string, len(v.members))
+		values := make([]Valuer, len(v.members))
+		for i, m := range v.members {
+			keys[i] = m.Key
+			values[i] = m.Value.valuer()
+		}
+		return objectOf(keys, values)
+	}
+	panic(fmt.Sprintf("bipf: invalid kind %s", v.kind))
+}
+
+// EncodedSize returns the size of the encoding of v, walking all of its content
+func (v *Value) EncodedSize() int {
+	return v.valuer().EncodedSize()
+}
+
+// WriteTo writes the encoding of v to w
+func (v *Value) WriteTo(w io.Writer) (int64, error) {
+	return v.valuer().WriteTo(w)
+}
+
+// MarshalBIPF implements Marshaler
+func (v *Value) MarshalBIPF() (Valuer, error) {
+	return v.valuer(), nil
+}
+
+// UnmarshalBIPF implements Unmarshaler by replacing v with the decoded data
+func (v *Value) UnmarshalBIPF(data []byte) error {
+	dec, err := DecodeValue(data)
+	if err != nil {
+		return err
+	}
+	*v = *dec
+	return nil
+}
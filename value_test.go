@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: MIT
+
+package bipf_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+func TestValueFixtures(t *testing.T) {
+	for _, f := range loadFixtures(t) {
+		f := f
+		t.Run(f.Name, func(t *testing.T) {
+			v, err := bipf.DecodeValue(f.Binary.Data())
+			require.NoError(t, err)
+			require.Equal(t, len(f.Binary), v.EncodedSize())
+			require.Equal(t, f.Binary.Data(), encodeValuer(t, v))
+		})
+	}
+}
+
+func TestValueMutate(t *testing.T) {
+	r := require.New(t)
+
+	data := encodeValuer(t, bipf.MapOf(map[string]bipf.Valuer{
+		"type":     bipf.String("post"),
+		"text":     bipf.String("hello"),
+		"mentions": bipf.ListOf(bipf.Int32(1)),
+		"root":     bipf.Null(),
+	}, "type", "text", "mentions", "root"))
+
+	v, err := bipf.DecodeValue(data)
+	r.NoError(err)
+	r.Equal(bipf.KindObject, v.Kind())
+	r.Equal(4, v.Len())
+
+	text, err := v.Get("text").Str()
+	r.NoError(err)
+	r.Equal("hello", text)
+	r.True(v.Get("root").IsNull())
+	r.Nil(v.Get("nope"))
+
+	r.NoError(v.Set("text", bipf.NewString("bye")))
+	r.NoError(v.Set("blob", bipf.NewBuffer([]byte{1, 2, 3})))
+	r.NoError(v.Get("mentions").Append(bipf.NewDouble(2.5), bipf.NewBool(true)))
+	r.True(v.Delete("root"))
+	r.False(v.Delete("root"))
+
+	want := bipf.MapOf(map[string]bipf.Valuer{
+		"type":     bipf.String("post"),
+		"text":     bipf.String("bye"),
+		"mentions": bipf.ListOf(bipf.Int32(1), bipf.Double(2.5), bipf.Bool(true)),
+		"blob":     bipf.Bytes([]byte{1, 2, 3}),
+	}, "type", "text", "mentions", "blob")
+	r.Equal(encodeValuer(t, want), encodeValuer(t, v))
+
+	// the decoded value doesn't share memory with the data
+	for i := range data {
+		data[i] = 0
+	}
+	r.Equal(encodeValuer(t, want), encodeValuer(t, v))
+}
+
+func TestValueKinds(t *testing.T) {
+	r := require.New(t)
+
+	_, err := bipf.NewInt32(1).Str()
+	var typeErr bipf.ErrUnexpectedType
+	r.True(errors.As(err, &typeErr), "unexpected error: %v", err)
+	r.Equal(bipf.TypeInt32, typeErr.Got)
+	r.Equal(bipf.TypeString, typeErr.Want)
+
+	_, err = bipf.NewNull().Bool()
+	r.Equal(bipf.ErrNull, err)
+
+	r.Error(bipf.NewString("x").Append(bipf.NewNull()))
+	r.Error(bipf.NewArray().Set("x", bipf.NewNull()))
+	r.Nil(bipf.NewArray(bipf.NewNull()).Index(1))
+	r.Equal("Null", bipf.KindNull.String())
+
+	// nil Values are encoded as null
+	got := encodeValuer(t, bipf.NewArray(nil, bipf.NewObject(bipf.Member{Key: "a"})))
+	r.Equal(encodeValuer(t, bipf.ListOf(bipf.Null(), bipf.MapOf(map[string]bipf.Valuer{"a": bipf.Null()}))), got)
+
+	_, err = bipf.DecodeValue([]byte{0x0e})
+	r.Error(err)
+
+	// Values wrapped in ListOf and MapOf keep the content they had
+	arr := bipf.NewArray(bipf.NewInt32(1))
+	wrapped := []bipf.Valuer{
+		bipf.ListOf(arr),
+		bipf.MapOf(map[string]bipf.Valuer{"a": arr}),
+	}
+	r.NoError(arr.Append(bipf.NewString("hello world")))
+	before := bipf.ListOf(bipf.Int32(1))
+	r.Equal(encodeValuer(t, bipf.ListOf(before)), encodeValuer(t, wrapped[0]))
+	r.Equal(encodeValuer(t, bipf.MapOf(map[string]bipf.Valuer{"a": before})), encodeValuer(t, wrapped[1]))
+}
+
+func TestValueMarshal(t *testing.T) {
+	r := require.New(t)
+
+	type envelope struct {
+		Key     string      `bipf:"key"`
+		Content *bipf.Value `bipf:"content"`
+	}
+
+	data, err := bipf.Marshal(envelope{
+		Key: "%abc",
+		Content: bipf.NewObject(
+			bipf.Member{Key: "type", Value: bipf.NewString("vote")},
+			bipf.Member{Key: "value", Value: bipf.NewInt32(1)},
+		),
+	})
+	r.NoError(err)
+
+	var got envelope
+	r.NoError(bipf.Unmarshal(data, &got))
+	r.Equal("%abc", got.Key)
+	r.Equal(bipf.KindObject, got.Content.Kind())
+	r.Equal([]string{"type", "value"}, []string{got.Content.Members()[0].Key, got.Content.Members()[1].Key})
+
+	again, err := bipf.Marshal(got)
+	r.NoError(err)
+	r.Equal(data, again)
+
+	canonical, err := bipf.MarshalCanonical(got.Content)
+	r.NoError(err)
+	r.True(bipf.IsCanonical(canonical))
+
+	// Values that aren't pointers
+	type inline struct {
+		Content bipf.Value `bipf:"content"`
+	}
+	data, err = bipf.Marshal(inline{Content: *got.Content})
+	r.NoError(err)
+	var gotInline inline
+	r.NoError(bipf.Unmarshal(data, &gotInline))
+	r.Equal(*got.Content, gotInline.Content)
+
+	direct, err := bipf.Marshal(*got.Content)
+	r.NoError(err)
+	r.Equal(encodeValuer(t, got.Content), direct)
+
+	repeated := bipf.NewObject(
+		bipf.Member{Key: "a", Value: bipf.NewInt32(1)},
+		bipf.Member{Key: "a", Value: bipf.NewInt32(2)},
+	)
+	_, err = bipf.Marshal(repeated)
+	r.NoError(err, "repeated keys are kept as they are")
+	_, err = bipf.MarshalCanonical(repeated)
+	r.Error(err, "but have no canonical encoding")
+}
@@ -0,0 +1,239 @@
+// SPDX-License-Identifier: MIT
+
+package bipf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/ssb-ngi-pointer/go-bipf/internal/varint"
+)
+
+// View is a read-only view of bipf encoded data that is already held in memory.
+//
+// Unlike the Decoder it keeps no state. All accessors take the offset of a value's tag
+// and return offsets or sub-slices of the view instead of copies, so they don't allocate.
+type View []byte
+
+// Tag decodes the tag at offset.
+// It returns the type and the length of the value and the offset of its first byte.
+func (v View) Tag(offset int) (typ Type, length int, valueStart int, err error) {
+	if offset < 0 || offset >= len(v) {
+		return typeUninited, 0, 0, fmt.Errorf("bipf: offset %d out of range: %w", offset, io.ErrUnexpectedEOF)
+	}
+
+	tag, n := varint.ConsumeVarint(v[offset:])
+	if n < 0 {
+		return typeUninited, 0, 0, fmt.Errorf("bipf: broken varint tag field at %d", offset)
+	}
+
+	typ = Type(tag & tagMask)
+	if typ >= TypeReserved {
+		return typeUninited, 0, 0, fmt.Errorf("bipf: invalid type at %d: %s", offset, typ)
+	}
+
+	valueStart = offset + n
+	valueLen := tag >> tagSize
+	if valueLen > uint64(len(v)-valueStart) {
+		return typeUninited, 0, 0, fmt.Errorf("bipf: value at %d is longer than the data (%d bytes): %w", offset, valueLen, io.ErrUnexpectedEOF)
+	}
+
+	return typ, int(valueLen), valueStart, nil
+}
+
+// Type returns the type of the value at offset
+func (v View) Type(offset int) (Type, error) {
+	typ, _, _, err := v.Tag(offset)
+	return typ, err
+}
+
+// Value returns the bytes of the value at offset, without the tag.
+func (v View) Value(offset int) ([]byte, error) {
+	_, length, start, err := v.Tag(offset)
+	if err != nil {
+		return nil, err
+	}
+	return v[start : start+length], nil
+}
+
+// Raw returns the complete encoding of the value at offset, including the tag.
+func (v View) Raw(offset int) ([]byte, error) {
+	_, length, start, err := v.Tag(offset)
+	if err != nil {
+		return nil, err
+	}
+	return v[offset : start+length], nil
+}
+
+// Skip returns the offset of the first byte after the value at offset.
+func (v View) Skip(offset int) (int, error) {
+	_, length, start, err := v.Tag(offset)
+	if err != nil {
+		return -1, err
+	}
+	return start + length, nil
+}
+
+// IsNull returns true if the value at offset is null
+func (v View) IsNull(offset int) bool {
+	typ, length, _, err := v.Tag(offset)
+	return err == nil && typ == TypeBool && length == 0
+}
+
+// Bool returns the value at offset if it is a bool.
+// If the value is null it returns ErrNull.
+func (v View) Bool(offset int) (bool, error) {
+	val, err := v.typedValue(offset, TypeBool)
+	if err != nil {
+		return false, err
+	}
+
+	switch len(val) {
+	case 0:
+		return false, ErrNull
+	case 1:
+	default:
+		return false, fmt.Errorf("bipf/bool: expected 1 bytes of value, not %d", len(val))
+	}
+
+	switch val[0] {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	default:
+		return false, fmt.Errorf("bipf: unexpected bool value: %d", val[0])
+	}
+}
+
+// Int32 returns the 32bit integer value at offset if it is an integer
+func (v View) Int32(offset int) (int32, error) {
+	val, err := v.typedValue(offset, TypeInt32)
+	if err != nil {
+		return -1, err
+	}
+
+	if len(val) != 4 {
+		return -1, fmt.Errorf("bipf/int32: expected 4 bytes of value, not %d", len(val))
+	}
+
+	return int32(binary.LittleEndian.Uint32(val)), nil
+}
+
+// Double returns the floating-point value at offset if it is a double
+func (v View) Double(offset int) (float64, error) {
+	val, err := v.typedValue(offset, TypeDouble)
+	if err != nil {
+		return -1, err
+	}
+
+	if len(val) != 8 {
+		return -1, fmt.Errorf("bipf/double: expected 8 bytes of value, not %d", len(val))
+	}
+
+	return math.Float64frombits(binary.LittleEndian.Uint64(val)), nil
+}
+
+// StringBytes returns the bytes of the string at offset.
+// The returned slice points into the view and must not be modified.
+func (v View) StringBytes(offset int) ([]byte, error) {
+	return v.typedValue(offset, TypeString)
+}
+
+// Buffer returns the bytes of the buffer at offset.
+// The returned slice points into the view and must not be modified.
+func (v View) Buffer(offset int) ([]byte, error) {
+	return v.typedValue(offset, TypeBuffer)
+}
+
+// SeekKey walks the entries of the object at offset and returns the offset of the value for key.
+// Values of other keys are skipped over without looking at them.
+func (v View) SeekKey(offset int, key string) (int, error) {
+	typ, length, start, err := v.Tag(offset)
+	if err != nil {
+		return -1, err
+	}
+	if want := TypeObject; typ != want {
+		return -1, ErrUnexpectedType{Want: want, Got: typ}
+	}
+	end := start + length
+
+	pos := start
+	for pos < end {
+		keyType, keyLen, keyStart, err := v.Tag(pos)
+		if err != nil {
+			return -1, err
+		}
+		if want := TypeString; keyType != want {
+			return -1, ErrUnexpectedType{Want: want, Got: keyType}
+		}
+
+		valueOffset := keyStart + keyLen
+		if valueOffset >= end {
+			return -1, ErrMalformed{Offset: pos, Reason: "object key without a value"}
+		}
+		if string(v[keyStart:valueOffset]) == key {
+			return valueOffset, nil
+		}
+
+		pos, err = v.Skip(valueOffset)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	return -1, fmt.Errorf("%w: %q", ErrNotFound, key)
+}
+
+// SeekIndex returns the offset of entry n of the array at offset.
+// The entries before it are skipped over without looking at them.
+func (v View) SeekIndex(offset int, n int) (int, error) {
+	typ, length, start, err := v.Tag(offset)
+	if err != nil {
+		return -1, err
+	}
+	if want := TypeArray; typ != want {
+		return -1, ErrUnexpectedType{Want: want, Got: typ}
+	}
+	end := start + length
+
+	pos := start
+	for i := 0; pos < end; i++ {
+		if i == n {
+			return pos, nil
+		}
+
+		pos, err = v.Skip(pos)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	return -1, fmt.Errorf("%w: index %d", ErrNotFound, n)
+}
+
+// SeekPath is like SeekKey but follows a chain of object key names.
+func (v View) SeekPath(offset int, labels ...string) (int, error) {
+	var err error
+	for _, label := range labels {
+		offset, err = v.SeekKey(offset, label)
+		if err != nil {
+			return -1, err
+		}
+	}
+	return offset, nil
+}
+
+// typedValue is like Value but also checks the type of the value
+func (v View) typedValue(offset int, want Type) ([]byte, error) {
+	typ, length, start, err := v.Tag(offset)
+	if err != nil {
+		return nil, err
+	}
+	if typ != want {
+		return nil, ErrUnexpectedType{Want: want, Got: typ}
+	}
+	return v[start : start+length], nil
+}
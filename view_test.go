@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: MIT
+
+package bipf_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssb-ngi-pointer/go-bipf"
+)
+
+func TestViewSeekPath(t *testing.T) {
+	r := require.New(t)
+
+	// {name: "bipf", repository: {type: "git", url: "git://github.com/ssbc/bipf.git"}, version: 1337}
+	theMap := bipf.MapOf(map[string]bipf.Valuer{
+		"name": bipf.String("bipf"),
+		"repository": bipf.MapOf(map[string]bipf.Valuer{
+			"type": bipf.String("git"),
+			"url":  bipf.String("git://github.com/ssbc/bipf.git"),
+		}, "type", "url"),
+		"version": bipf.Int32(1337),
+	}, "name", "repository", "version")
+
+	var buf bytes.Buffer
+	_, err := theMap.WriteTo(&buf)
+	r.NoError(err)
+	v := bipf.View(buf.Bytes())
+
+	off, err := v.SeekPath(0, "repository", "url")
+	r.NoError(err)
+	url, err := v.StringBytes(off)
+	r.NoError(err)
+	r.Equal("git://github.com/ssbc/bipf.git", string(url))
+
+	off, err = v.SeekKey(0, "version")
+	r.NoError(err)
+	i, err := v.Int32(off)
+	r.NoError(err)
+	r.EqualValues(1337, i)
+
+	_, err = v.SeekKey(0, "nope")
+	r.True(errors.Is(err, bipf.ErrNotFound), "unexpected error: %v", err)
+
+	_, err = v.StringBytes(0)
+	r.Equal(bipf.ErrUnexpectedType{Want: bipf.TypeString, Got: bipf.TypeObject}, err)
+
+	// truncated input
+	_, err = v[:len(v)-1].SeekPath(0, "version")
+	r.Error(err)
+
+	// {"a"} followed by true, the key must not pick up the value after the object
+	_, err = bipf.View{0x15, 0x08, 0x61, 0x0e, 0x01}.SeekKey(0, "a")
+	var malformed bipf.ErrMalformed
+	r.True(errors.As(err, &malformed), "unexpected error: %v", err)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		off, err := v.SeekPath(0, "repository", "url")
+		if err != nil {
+			panic(err)
+		}
+		if _, err = v.StringBytes(off); err != nil {
+			panic(err)
+		}
+	})
+	r.Zero(allocs)
+}
+
+func TestViewScalars(t *testing.T) {
+	r := require.New(t)
+
+	// [-1, true, "hello"]
+	data, err := hex.DecodeString("6422ffffffff0e012868656c6c6f")
+	r.NoError(err)
+	v := bipf.View(data)
+
+	typ, length, start, err := v.Tag(0)
+	r.NoError(err)
+	r.Equal(bipf.TypeArray, typ)
+	r.Equal(12, length)
+	r.Equal(1, start)
+
+	i, err := v.Int32(start)
+	r.NoError(err)
+	r.EqualValues(-1, i)
+
+	next, err := v.Skip(start)
+	r.NoError(err)
+	b, err := v.Bool(next)
+	r.NoError(err)
+	r.True(b)
+
+	next, err = v.Skip(next)
+	r.NoError(err)
+	str, err := v.StringBytes(next)
+	r.NoError(err)
+	r.Equal("hello", string(str))
+
+	raw, err := v.Raw(next)
+	r.NoError(err)
+	r.Equal(data[next:], []byte(raw))
+
+	end, err := v.Skip(next)
+	r.NoError(err)
+	r.Equal(len(data), end)
+
+	_, err = v.Type(end)
+	r.Error(err)
+}